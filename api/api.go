@@ -0,0 +1,492 @@
+// Package api exposes the mailer over authenticated JSON endpoints:
+//
+//	POST /v1/emails           sends a single templated email
+//	POST /v1/campaigns        starts a campaign from an uploaded CSV file
+//	GET  /v1/campaigns/{id}   returns the progress of a campaign
+//
+// Requests must have an "Authorization: Bearer <token>" header. POST requests
+// with an Idempotency-Key header are answered only once, and retries with the
+// same key get the same response without sending anything again.
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/campaign"
+	"github.com/reneepc/gopher-lite-mailer/logging"
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/metrics"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+	"golang.org/x/time/rate"
+)
+
+// maxRequestSize limits the size of request bodies, including uploaded CSV
+// files.
+const maxRequestSize = 10 << 20
+
+// Sender sends a rendered email and returns the name of the account that sent
+// it, or sends a batch of records with their results. It is implemented by
+// *mailer.Pool.
+type Sender interface {
+	SendEmail(to string, email mailer.Email) (string, error)
+	SendBatch(ctx context.Context, template mailer.EmailTemplate, records []parser.MailRecord, opts mailer.BatchOptions) <-chan mailer.RecordResult
+}
+
+// Config holds the settings of a Server.
+type Config struct {
+	// Token is the secret clients must send as a bearer token.
+	Token string
+	// TemplatesRoot is the directory with the template directories.
+	TemplatesRoot string
+	// Defaults provides the template directory, subject and signature of
+	// requests that do not set them.
+	Defaults  campaign.Campaign
+	Sender    Sender
+	RateLimit campaign.RateLimit
+	// IdempotencyFile keeps the responses to requests with an idempotency
+	// key across restarts. When empty they are kept in memory only.
+	IdempotencyFile string
+	// CampaignsFile keeps the status of the campaigns across restarts. When
+	// empty it is kept in memory only.
+	CampaignsFile string
+}
+
+// Server is the http.Handler of the API.
+type Server struct {
+	config    Config
+	mux       *http.ServeMux
+	limiter   *rate.Limiter
+	keys      *idempotencyStore
+	campaigns *campaignStore
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewServer creates a Server. Close must be called to stop the campaigns it
+// started.
+func NewServer(config Config) (*Server, error) {
+	if config.Token == "" {
+		return nil, errors.New("API token is required")
+	}
+	if config.Sender == nil {
+		return nil, errors.New("sender is required")
+	}
+
+	keys, err := openIdempotencyStore(config.IdempotencyFile)
+	if err != nil {
+		return nil, err
+	}
+	campaigns, err := openCampaignStore(config.CampaignsFile)
+	if err != nil {
+		return nil, err
+	}
+
+	limit := rate.Inf
+	if config.RateLimit.Interval > 0 {
+		limit = rate.Every(config.RateLimit.Interval)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Server{
+		config:    config,
+		mux:       http.NewServeMux(),
+		limiter:   rate.NewLimiter(limit, config.RateLimit.Burst),
+		keys:      keys,
+		campaigns: campaigns,
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+
+	s.mux.HandleFunc("POST /v1/emails", s.idempotent(s.handleSendEmail))
+	s.mux.HandleFunc("POST /v1/campaigns", s.idempotent(s.handleStartCampaign))
+	s.mux.HandleFunc("GET /v1/campaigns/{id}", s.handleCampaignStatus)
+
+	return s, nil
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || subtle.ConstantTimeCompare([]byte(token), []byte(s.config.Token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid token")
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestSize)
+	s.mux.ServeHTTP(w, r)
+}
+
+// Close stops the running campaigns and waits for them to return.
+func (s *Server) Close() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// EmailRequest is the body of POST /v1/emails.
+type EmailRequest struct {
+	To string `json:"to"`
+	// Dir is the template directory. It defaults to the one of the server.
+	Dir     string            `json:"dir,omitempty"`
+	Body    string            `json:"body"`
+	Subject string            `json:"subject,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// Validate checks that the request has a valid recipient and a template that
+// stays inside the templates directory.
+func (r EmailRequest) Validate() []string {
+	var problems []string
+	if r.To == "" {
+		problems = append(problems, "to: is required")
+	} else if _, err := mail.ParseAddress(r.To); err != nil {
+		problems = append(problems, fmt.Sprintf("to: invalid address %q", r.To))
+	}
+	return append(problems, validateTemplate(r.Dir, r.Body)...)
+}
+
+func validateTemplate(dir, body string) []string {
+	var problems []string
+	if body == "" {
+		problems = append(problems, "body: is required")
+	} else if !filepath.IsLocal(body) {
+		problems = append(problems, fmt.Sprintf("body: invalid file name %q", body))
+	}
+	if dir != "" && !filepath.IsLocal(dir) {
+		problems = append(problems, fmt.Sprintf("dir: invalid directory %q", dir))
+	}
+	return problems
+}
+
+// EmailResponse is the body of a successful POST /v1/emails.
+type EmailResponse struct {
+	Status  string `json:"status"`
+	To      string `json:"to"`
+	Account string `json:"account"`
+}
+
+func (s *Server) handleSendEmail(w http.ResponseWriter, r *http.Request) {
+	var request EmailRequest
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&request); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("could not parse request: %v", err))
+		return
+	}
+	if problems := request.Validate(); len(problems) > 0 {
+		writeError(w, http.StatusBadRequest, "invalid request", problems...)
+		return
+	}
+
+	template, err := s.template(request.Dir, request.Body, request.Subject)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request", err.Error())
+		return
+	}
+
+	email, err := template.Render(r.Context(), request.Data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request", fmt.Sprintf("data: could not execute template: %v", err))
+		return
+	}
+
+	if err := metrics.WaitRateLimit(r.Context(), s.limiter); err != nil {
+		writeError(w, http.StatusServiceUnavailable, "request cancelled")
+		return
+	}
+
+	account, err := s.config.Sender.SendEmail(request.To, email)
+
+	var quotaErr *mailer.QuotaError
+	if errors.As(err, &quotaErr) {
+		if !quotaErr.RetryAt.IsZero() {
+			w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(quotaErr.RetryAt).Seconds())+1))
+		}
+		writeError(w, http.StatusTooManyRequests, "daily quota reached by every sender account")
+		return
+	}
+	if err != nil {
+		slog.Error("❌ Could not send email", slog.String(logging.KeyRecipient, request.To), slog.String(logging.KeyAccount, account), slog.Any("error", err))
+		writeError(w, http.StatusBadGateway, fmt.Sprintf("could not send email: %v", err))
+		return
+	}
+
+	slog.Info("✅ Email successfully sent", slog.String(logging.KeyRecipient, request.To), slog.String(logging.KeyAccount, account))
+	writeJSON(w, http.StatusOK, EmailResponse{Status: "sent", To: request.To, Account: account})
+}
+
+// Campaign states.
+const (
+	CampaignRunning  = "running"
+	CampaignFinished = "finished"
+	CampaignStopped  = "stopped"
+)
+
+// CampaignStatus is the progress of a campaign started through the API.
+type CampaignStatus struct {
+	ID         string           `json:"id"`
+	Status     string           `json:"status"`
+	Total      int              `json:"total"`
+	Sent       int              `json:"sent"`
+	Failed     int              `json:"failed"`
+	Skipped    int              `json:"skipped"`
+	Errors     []RecipientError `json:"errors,omitempty"`
+	Reason     string           `json:"reason,omitempty"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt *time.Time       `json:"finished_at,omitempty"`
+}
+
+// RecipientError tells why the email of a recipient was not sent.
+type RecipientError struct {
+	Email string `json:"email"`
+	Error string `json:"error"`
+}
+
+// handleStartCampaign reads a multipart form with the "body", "subject" and
+// "dir" fields and the CSV file in the "data" field, and sends the campaign in
+// the background.
+func (s *Server) handleStartCampaign(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseMultipartForm(maxRequestSize); err != nil {
+		writeError(w, http.StatusBadRequest, fmt.Sprintf("could not parse form: %v", err))
+		return
+	}
+
+	dir, body, subject := r.FormValue("dir"), r.FormValue("body"), r.FormValue("subject")
+	problems := validateTemplate(dir, body)
+
+	var records []parser.MailRecord
+	file, _, err := r.FormFile("data")
+	if err != nil {
+		problems = append(problems, "data: CSV file is required")
+	} else {
+		defer file.Close()
+		records, err = parser.ReadRecords(file)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("data: %v", err))
+		}
+	}
+	if len(problems) > 0 {
+		writeError(w, http.StatusBadRequest, "invalid request", problems...)
+		return
+	}
+
+	template, err := s.template(dir, body, subject)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request", err.Error())
+		return
+	}
+
+	id, err := newID()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	status := CampaignStatus{
+		ID:        id,
+		Status:    CampaignRunning,
+		Total:     len(records),
+		StartedAt: time.Now(),
+	}
+	if err := s.campaigns.add(status); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runCampaign(id, template, records)
+	}()
+
+	slog.Info("🚀 Campaign started", slog.String(logging.KeyCampaign, id), slog.Int("recipients", len(records)))
+	w.Header().Set("Location", "/v1/campaigns/"+id)
+	writeJSON(w, http.StatusAccepted, status)
+}
+
+// runCampaign sends the campaign through the sender with the rate limit of the
+// server, saving its status after each email.
+func (s *Server) runCampaign(id string, template mailer.EmailTemplate, records []parser.MailRecord) {
+	results := s.config.Sender.SendBatch(s.ctx, template, records, mailer.BatchOptions{
+		Wait: func(ctx context.Context, record parser.MailRecord) error {
+			return metrics.WaitRateLimit(ctx, s.limiter)
+		},
+	})
+
+	update := func(change func(*CampaignStatus)) {
+		if err := s.campaigns.update(id, change); err != nil {
+			slog.Error("could not save campaign status", slog.String(logging.KeyCampaign, id), slog.Any("error", err))
+		}
+	}
+
+	var reason string
+	for result := range results {
+		switch result.Status {
+		case mailer.StatusSent:
+			slog.Info("✅ Email successfully sent", slog.String(logging.KeyCampaign, id), slog.String(logging.KeyRecipient, result.Record.Email), slog.String(logging.KeyAccount, result.Account))
+		case mailer.StatusFailed:
+			slog.Error("❌ Could not send email", slog.String(logging.KeyCampaign, id), slog.String(logging.KeyRecipient, result.Record.Email), slog.String(logging.KeyAccount, result.Account), slog.Any("error", result.Err))
+		case mailer.StatusSkipped:
+			if reason == "" {
+				reason = skipReason(result.Err)
+			}
+		}
+
+		update(func(status *CampaignStatus) {
+			switch result.Status {
+			case mailer.StatusSent:
+				status.Sent++
+			case mailer.StatusFailed:
+				status.Failed++
+				status.Errors = append(status.Errors, RecipientError{Email: result.Record.Email, Error: result.Err.Error()})
+			case mailer.StatusSkipped:
+				status.Skipped++
+			}
+		})
+	}
+
+	update(func(status *CampaignStatus) {
+		finishedAt := time.Now()
+		status.FinishedAt = &finishedAt
+		if reason != "" {
+			status.Status = CampaignStopped
+			status.Reason = reason
+		} else {
+			status.Status = CampaignFinished
+		}
+	})
+}
+
+// skipReason tells why the records of a campaign were skipped, which is either
+// the daily quota or the server shutting down.
+func skipReason(err error) string {
+	var quotaErr *mailer.QuotaError
+	if errors.As(err, &quotaErr) {
+		return quotaErr.Error()
+	}
+	return "server shutting down"
+}
+
+func (s *Server) handleCampaignStatus(w http.ResponseWriter, r *http.Request) {
+	status, ok := s.campaigns.get(r.PathValue("id"))
+	if !ok {
+		writeError(w, http.StatusNotFound, "unknown campaign")
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// idempotent replays the stored response to requests whose Idempotency-Key
+// was already answered. Responses are stored unless they are server errors or
+// ask the client to come back later, which are safe to retry.
+func (s *Server) idempotent(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next(w, r)
+			return
+		}
+
+		stored, err := s.keys.begin(key, r.Method+" "+r.URL.Path)
+		if errors.Is(err, errKeyInProgress) {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity, err.Error())
+			return
+		}
+		if stored != nil {
+			w.Header().Set("Content-Type", "application/json")
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(stored.Status)
+			w.Write(stored.Body)
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: w, status: http.StatusOK}
+		next(recorder, r)
+
+		if recorder.status >= 500 || recorder.status == http.StatusTooManyRequests {
+			s.keys.release(key)
+			return
+		}
+		if err := s.keys.finish(key, recorder.status, recorder.body.Bytes()); err != nil {
+			slog.Error("could not save idempotency key", slog.Any("error", err))
+		}
+	}
+}
+
+// responseRecorder writes the response and keeps a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	r.body.Write(p)
+	return r.ResponseWriter.Write(p)
+}
+
+// template loads a body with the options of the default campaign, like the
+// other commands, and the subject of the request, falling back to the default
+// subject and then to the front matter of the body.
+func (s *Server) template(dir, body, subject string) (mailer.EmailTemplate, error) {
+	if dir == "" {
+		dir = s.config.Defaults.Dir
+	}
+	builder := s.config.Defaults.TemplateBuilder(s.config.TemplatesRoot, dir, body)
+	if subject != "" {
+		builder = builder.WithSubject(subject)
+	}
+	template, err := builder.Build()
+	if err != nil {
+		return mailer.EmailTemplate{}, fmt.Errorf("body: could not load template %s/%s", dir, body)
+	}
+	return template, nil
+}
+
+func newID() (string, error) {
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("could not create campaign id: %v", err)
+	}
+	return hex.EncodeToString(id), nil
+}
+
+type errorResponse struct {
+	Error   string   `json:"error"`
+	Details []string `json:"details,omitempty"`
+}
+
+func writeError(w http.ResponseWriter, status int, message string, details ...string) {
+	writeJSON(w, status, errorResponse{Error: message, Details: details})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
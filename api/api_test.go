@@ -0,0 +1,402 @@
+package api_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/api"
+	"github.com/reneepc/gopher-lite-mailer/campaign"
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+)
+
+const token = "secret"
+
+type fakeSender struct {
+	mu     sync.Mutex
+	sent   []string
+	emails []mailer.Email
+	err    error
+}
+
+func (f *fakeSender) SendEmail(to string, email mailer.Email) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return "", f.err
+	}
+	f.sent = append(f.sent, to)
+	f.emails = append(f.emails, email)
+	return "golangsp", nil
+}
+
+// SendBatch sends the records one at a time with SendEmail.
+func (f *fakeSender) SendBatch(ctx context.Context, template mailer.EmailTemplate, records []parser.MailRecord, opts mailer.BatchOptions) <-chan mailer.RecordResult {
+	results := make(chan mailer.RecordResult, len(records))
+	go func() {
+		defer close(results)
+		for i, record := range records {
+			result := mailer.RecordResult{Index: i, Record: record, Status: mailer.StatusFailed}
+			if opts.Wait != nil {
+				if err := opts.Wait(ctx, record); err != nil {
+					result.Status, result.Err = mailer.StatusSkipped, err
+					results <- result
+					continue
+				}
+			}
+
+			email, err := template.Render(ctx, record.Data)
+			if err == nil {
+				result.Account, err = f.SendEmail(record.Email, email)
+			}
+			if err == nil {
+				result.Status = mailer.StatusSent
+			}
+			result.Err = err
+			results <- result
+		}
+	}()
+	return results
+}
+
+func (f *fakeSender) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.sent)
+}
+
+func createTemplates(t *testing.T) string {
+	t.Helper()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"standard/header.html":       "<html><head><style>{{.CSS}}</style></head><body>",
+		"standard/styles.css":        "p { color: #333 }",
+		"standard/footer.html":       "</body></html>",
+		"standard/bodies/hello.html": "<p>Hello, {{ .Data.Nome }}!</p>",
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to create template: %v", err)
+		}
+	}
+	return root
+}
+
+func newTestServer(t *testing.T, sender *fakeSender) *api.Server {
+	t.Helper()
+	return newTestServerWithDefaults(t, sender, campaign.Default())
+}
+
+func newTestServerWithDefaults(t *testing.T, sender *fakeSender, defaults campaign.Campaign) *api.Server {
+	t.Helper()
+
+	server, err := api.NewServer(api.Config{
+		Token:           token,
+		TemplatesRoot:   createTemplates(t),
+		Defaults:        defaults,
+		Sender:          sender,
+		RateLimit:       campaign.RateLimit{Burst: 1},
+		IdempotencyFile: filepath.Join(t.TempDir(), "idempotency.json"),
+	})
+	if err != nil {
+		t.Fatalf("Failed to create server: %v", err)
+	}
+	t.Cleanup(server.Close)
+	return server
+}
+
+func do(t *testing.T, server http.Handler, request *http.Request) *httptest.ResponseRecorder {
+	t.Helper()
+
+	if request.Header.Get("Authorization") == "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	recorder := httptest.NewRecorder()
+	server.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestServer_SendEmail(t *testing.T) {
+	tests := map[string]struct {
+		body           string
+		authorization  string
+		sendErr        error
+		expectedStatus int
+		expectedBody   string
+	}{
+		"Sent": {
+			body:           `{"to": "gopher@example.com", "body": "hello.html", "data": {"Nome": "Gopher"}}`,
+			expectedStatus: http.StatusOK,
+			expectedBody:   `"status":"sent"`,
+		},
+		"Invalid Token": {
+			body:           `{"to": "gopher@example.com", "body": "hello.html"}`,
+			authorization:  "Bearer wrong",
+			expectedStatus: http.StatusUnauthorized,
+		},
+		"Invalid Fields": {
+			body:           `{"to": "gopher", "body": "../../etc/passwd"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `"details":["to: invalid address \"gopher\"","body: invalid file name \"../../etc/passwd\""]`,
+		},
+		"Unknown Field": {
+			body:           `{"to": "gopher@example.com", "body": "hello.html", "cc": "x@example.com"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `unknown field`,
+		},
+		"Unknown Template": {
+			body:           `{"to": "gopher@example.com", "body": "missing.html"}`,
+			expectedStatus: http.StatusBadRequest,
+			expectedBody:   `could not load template`,
+		},
+		"Quota Reached": {
+			body:           `{"to": "gopher@example.com", "body": "hello.html"}`,
+			sendErr:        &mailer.QuotaError{RetryAt: time.Now().Add(time.Hour)},
+			expectedStatus: http.StatusTooManyRequests,
+		},
+		"Send Failure": {
+			body:           `{"to": "gopher@example.com", "body": "hello.html"}`,
+			sendErr:        errors.New("connection refused"),
+			expectedStatus: http.StatusBadGateway,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestServer(t, &fakeSender{err: tt.sendErr})
+
+			request := httptest.NewRequest(http.MethodPost, "/v1/emails", strings.NewReader(tt.body))
+			request.Header.Set("Authorization", tt.authorization)
+			response := do(t, server, request)
+
+			if response.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, response.Code, response.Body)
+			}
+			if !strings.Contains(response.Body.String(), tt.expectedBody) {
+				t.Errorf("expected body containing %s, got %s", tt.expectedBody, response.Body)
+			}
+		})
+	}
+}
+
+func TestServer_SendEmailTemplateOptions(t *testing.T) {
+	defaults := campaign.Default()
+	defaults.Subject = "Olá, {{.Data.Nome}}"
+	defaults.Preheader = "Até breve, {{.Data.Nome}}"
+	defaults.InlineCSS = true
+	defaults.Strict = true
+
+	tests := map[string]struct {
+		body            string
+		expectedStatus  int
+		expectedSubject string
+	}{
+		"Default Subject": {
+			body:            `{"to": "gopher@example.com", "body": "hello.html", "data": {"Nome": "Gopher"}}`,
+			expectedStatus:  http.StatusOK,
+			expectedSubject: "Olá, Gopher",
+		},
+		"Subject Of The Request": {
+			body:            `{"to": "gopher@example.com", "body": "hello.html", "subject": "Oi", "data": {"Nome": "Gopher"}}`,
+			expectedStatus:  http.StatusOK,
+			expectedSubject: "Oi",
+		},
+		"Strict Without A Field": {
+			body:           `{"to": "gopher@example.com", "body": "hello.html"}`,
+			expectedStatus: http.StatusBadRequest,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			sender := &fakeSender{}
+			server := newTestServerWithDefaults(t, sender, defaults)
+
+			response := do(t, server, httptest.NewRequest(http.MethodPost, "/v1/emails", strings.NewReader(tt.body)))
+			if response.Code != tt.expectedStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.expectedStatus, response.Code, response.Body)
+			}
+			if tt.expectedStatus != http.StatusOK {
+				return
+			}
+
+			email := sender.emails[0]
+			if email.Subject != tt.expectedSubject {
+				t.Errorf("expected subject %q, got %q", tt.expectedSubject, email.Subject)
+			}
+			for _, expected := range []string{`color: transparent;">Até breve, Gopher`, `<p style="color: #333;">Hello, Gopher!</p>`} {
+				if !strings.Contains(email.Body, expected) {
+					t.Errorf("expected %q in body:\n%s", expected, email.Body)
+				}
+			}
+		})
+	}
+}
+
+func TestServer_IdempotencyKey(t *testing.T) {
+	sender := &fakeSender{}
+	server := newTestServer(t, sender)
+
+	send := func(key string) *httptest.ResponseRecorder {
+		request := httptest.NewRequest(http.MethodPost, "/v1/emails", strings.NewReader(`{"to": "gopher@example.com", "body": "hello.html"}`))
+		request.Header.Set("Idempotency-Key", key)
+		return do(t, server, request)
+	}
+
+	first := send("registration-42")
+	retry := send("registration-42")
+	if first.Code != http.StatusOK || retry.Code != http.StatusOK {
+		t.Fatalf("expected both responses to succeed, got %d and %d", first.Code, retry.Code)
+	}
+	if retry.Header().Get("Idempotent-Replayed") != "true" || retry.Body.String() != first.Body.String() {
+		t.Errorf("expected the retry to replay the first response, got %s", retry.Body)
+	}
+	if sender.count() != 1 {
+		t.Errorf("expected a single email to be sent, got %d", sender.count())
+	}
+
+	send("registration-43")
+	if sender.count() != 2 {
+		t.Errorf("expected another key to send again, got %d emails", sender.count())
+	}
+
+	request := httptest.NewRequest(http.MethodGet, "/v1/campaigns/unknown", nil)
+	if response := do(t, server, request); response.Code != http.StatusNotFound {
+		t.Errorf("expected unknown campaign to be not found, got %d", response.Code)
+	}
+}
+
+func TestServer_Campaign(t *testing.T) {
+	sender := &fakeSender{}
+	server := newTestServer(t, sender)
+
+	status := startCampaign(t, server)
+	if status.Total != 2 {
+		t.Fatalf("unexpected campaign: %+v", status)
+	}
+
+	status = waitForCampaign(t, server, status.ID)
+	if status.Status != api.CampaignFinished || status.Sent != 2 || status.Failed != 0 || status.FinishedAt == nil {
+		t.Errorf("expected every recipient to be sent, got %+v", status)
+	}
+}
+
+func TestServer_CampaignAfterRestart(t *testing.T) {
+	root := createTemplates(t)
+	campaignsFile := filepath.Join(t.TempDir(), "campaigns.json")
+	newServer := func() *api.Server {
+		server, err := api.NewServer(api.Config{
+			Token:         token,
+			TemplatesRoot: root,
+			Defaults:      campaign.Default(),
+			Sender:        &fakeSender{},
+			RateLimit:     campaign.RateLimit{Burst: 1},
+			CampaignsFile: campaignsFile,
+		})
+		if err != nil {
+			t.Fatalf("Failed to create server: %v", err)
+		}
+		return server
+	}
+
+	server := newServer()
+	finished := waitForCampaign(t, server, startCampaign(t, server).ID)
+	server.Close()
+
+	// A campaign left running by a crash of the server.
+	content, err := os.ReadFile(campaignsFile)
+	if err != nil {
+		t.Fatalf("Failed to read campaigns file: %v", err)
+	}
+	var campaigns map[string]api.CampaignStatus
+	if err := json.Unmarshal(content, &campaigns); err != nil {
+		t.Fatalf("Failed to parse campaigns file: %v", err)
+	}
+	campaigns["crashed"] = api.CampaignStatus{ID: "crashed", Status: api.CampaignRunning, Total: 3, Sent: 1, StartedAt: time.Now()}
+	content, _ = json.Marshal(campaigns)
+	if err := os.WriteFile(campaignsFile, content, 0600); err != nil {
+		t.Fatalf("Failed to write campaigns file: %v", err)
+	}
+
+	restarted := newServer()
+	t.Cleanup(restarted.Close)
+
+	var status api.CampaignStatus
+	response := do(t, restarted, httptest.NewRequest(http.MethodGet, "/v1/campaigns/"+finished.ID, nil))
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if response.Code != http.StatusOK || status.Status != api.CampaignFinished || status.Sent != 2 {
+		t.Errorf("expected the finished campaign to be kept, got %d: %+v", response.Code, status)
+	}
+
+	response = do(t, restarted, httptest.NewRequest(http.MethodGet, "/v1/campaigns/crashed", nil))
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode status: %v", err)
+	}
+	if status.Status != api.CampaignStopped || status.Sent != 1 || !strings.Contains(status.Reason, "restarted") {
+		t.Errorf("expected the running campaign to be stopped by the restart, got %+v", status)
+	}
+}
+
+// startCampaign posts a campaign with two recipients.
+func startCampaign(t *testing.T, server http.Handler) api.CampaignStatus {
+	t.Helper()
+
+	var form bytes.Buffer
+	writer := multipart.NewWriter(&form)
+	writer.WriteField("body", "hello.html")
+	writer.WriteField("subject", "Confirmação")
+	file, _ := writer.CreateFormFile("data", "data.csv")
+	file.Write([]byte("Nome,Email\nGopher,gopher@example.com\nFerris,ferris@example.com\n"))
+	writer.Close()
+
+	request := httptest.NewRequest(http.MethodPost, "/v1/campaigns", &form)
+	request.Header.Set("Content-Type", writer.FormDataContentType())
+	response := do(t, server, request)
+	if response.Code != http.StatusAccepted {
+		t.Fatalf("expected campaign to be accepted, got %d: %s", response.Code, response.Body)
+	}
+
+	var status api.CampaignStatus
+	if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+		t.Fatalf("Failed to decode response: %v", err)
+	}
+	if response.Header().Get("Location") != "/v1/campaigns/"+status.ID {
+		t.Fatalf("unexpected location %q for campaign %+v", response.Header().Get("Location"), status)
+	}
+	return status
+}
+
+// waitForCampaign polls the status of the campaign until it is not running.
+func waitForCampaign(t *testing.T, server http.Handler, id string) api.CampaignStatus {
+	t.Helper()
+
+	status := api.CampaignStatus{Status: api.CampaignRunning}
+	deadline := time.Now().Add(5 * time.Second)
+	for status.Status == api.CampaignRunning && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		response := do(t, server, httptest.NewRequest(http.MethodGet, "/v1/campaigns/"+id, nil))
+		if err := json.NewDecoder(response.Body).Decode(&status); err != nil {
+			t.Fatalf("Failed to decode status: %v", err)
+		}
+	}
+	return status
+}
@@ -0,0 +1,142 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// CampaignRetention is how long the status of a finished campaign is kept.
+const CampaignRetention = 7 * 24 * time.Hour
+
+// reasonRestarted is the reason of the campaigns that were running when the
+// server stopped without finishing them, such as when it crashed.
+const reasonRestarted = "server restarted while the campaign was running, the recipients not counted as sent or failed were not sent, except the ones being sent at that moment"
+
+// campaignStore keeps the status of the campaigns by id, in a JSON file when
+// it has a path, so they can still be queried after a restart.
+type campaignStore struct {
+	path string
+	now  func() time.Time
+
+	mu        sync.Mutex
+	campaigns map[string]*CampaignStatus
+}
+
+func openCampaignStore(path string) (*campaignStore, error) {
+	s := &campaignStore{
+		path:      path,
+		now:       time.Now,
+		campaigns: make(map[string]*CampaignStatus),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read campaigns file: %v", err)
+	}
+
+	if err := json.Unmarshal(content, &s.campaigns); err != nil {
+		return nil, fmt.Errorf("could not parse campaigns file %s: %v", path, err)
+	}
+
+	// No campaign runs once the server starts, so the running ones were cut
+	// short by the previous run.
+	for _, status := range s.campaigns {
+		if status.Status == CampaignRunning {
+			status.Status = CampaignStopped
+			status.Reason = reasonRestarted
+		}
+	}
+
+	return s, nil
+}
+
+// add stores the status of a new campaign.
+func (s *campaignStore) add(status CampaignStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.campaigns[status.ID] = &status
+	return s.save()
+}
+
+// update changes the status of the campaign and saves it.
+func (s *campaignStore) update(id string, change func(*CampaignStatus)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.campaigns[id]
+	if !ok {
+		return nil
+	}
+	change(status)
+	return s.save()
+}
+
+// get returns a copy of the status of the campaign.
+func (s *campaignStore) get(id string) (CampaignStatus, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status, ok := s.campaigns[id]
+	if !ok {
+		return CampaignStatus{}, false
+	}
+	snapshot := *status
+	snapshot.Errors = append([]RecipientError(nil), status.Errors...)
+	return snapshot, true
+}
+
+// save drops the campaigns finished before the retention and writes the
+// others to a temporary file renamed over the previous one. Callers must hold
+// mu.
+func (s *campaignStore) save() error {
+	for id, status := range s.campaigns {
+		if status.FinishedAt != nil && s.now().Sub(*status.FinishedAt) >= CampaignRetention {
+			delete(s.campaigns, id)
+		}
+	}
+
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s.campaigns, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode campaigns file: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("could not create state directory: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write campaigns file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write campaigns file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write campaigns file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("could not write campaigns file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// IdempotencyWindow is how long the response to a request with an
+// Idempotency-Key header is kept and replayed to retries with the same key.
+const IdempotencyWindow = 24 * time.Hour
+
+// storedResponse is the response to a request with an idempotency key.
+type storedResponse struct {
+	Endpoint  string          `json:"endpoint"`
+	Status    int             `json:"status"`
+	Body      json.RawMessage `json:"body"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// idempotencyStore keeps the responses by idempotency key, in a JSON file when
+// it has a path, so a retry after a restart is not sent twice either.
+type idempotencyStore struct {
+	path string
+	now  func() time.Time
+
+	mu         sync.Mutex
+	responses  map[string]storedResponse
+	inProgress map[string]string
+}
+
+func openIdempotencyStore(path string) (*idempotencyStore, error) {
+	s := &idempotencyStore{
+		path:       path,
+		now:        time.Now,
+		responses:  make(map[string]storedResponse),
+		inProgress: make(map[string]string),
+	}
+	if path == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read idempotency file: %v", err)
+	}
+
+	if err := json.Unmarshal(content, &s.responses); err != nil {
+		return nil, fmt.Errorf("could not parse idempotency file %s: %v", path, err)
+	}
+
+	return s, nil
+}
+
+var (
+	errKeyInProgress = errors.New("a request with this idempotency key is in progress")
+	errKeyReused     = errors.New("idempotency key was already used for another endpoint")
+)
+
+// begin reserves the key for a request to endpoint. It returns the stored
+// response when the key was already used for the same endpoint.
+func (s *idempotencyStore) begin(key, endpoint string) (*storedResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if response, ok := s.responses[key]; ok && s.now().Sub(response.CreatedAt) < IdempotencyWindow {
+		if response.Endpoint != endpoint {
+			return nil, errKeyReused
+		}
+		return &response, nil
+	}
+
+	if inProgress, ok := s.inProgress[key]; ok {
+		if inProgress != endpoint {
+			return nil, errKeyReused
+		}
+		return nil, errKeyInProgress
+	}
+
+	s.inProgress[key] = endpoint
+	return nil, nil
+}
+
+// finish stores the response for the key reserved by begin.
+func (s *idempotencyStore) finish(key string, status int, body []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.responses[key] = storedResponse{
+		Endpoint:  s.inProgress[key],
+		Status:    status,
+		Body:      body,
+		CreatedAt: s.now(),
+	}
+	delete(s.inProgress, key)
+
+	return s.save()
+}
+
+// release frees the key reserved by begin without storing a response, so the
+// request can be retried.
+func (s *idempotencyStore) release(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inProgress, key)
+}
+
+// save drops the expired responses and writes the others to a temporary file
+// renamed over the previous one. Callers must hold mu.
+func (s *idempotencyStore) save() error {
+	for key, response := range s.responses {
+		if s.now().Sub(response.CreatedAt) >= IdempotencyWindow {
+			delete(s.responses, key)
+		}
+	}
+
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := json.MarshalIndent(s.responses, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode idempotency file: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0700); err != nil {
+		return fmt.Errorf("could not create state directory: %v", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0600); err != nil {
+		return fmt.Errorf("could not write idempotency file: %v", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("could not write idempotency file: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/api"
+	"github.com/reneepc/gopher-lite-mailer/credentials"
+)
+
+func runAPI(args []string) error {
+	fs := newFlagSet("api", "[email]",
+		"Serves authenticated JSON endpoints to send emails from other services:\n\n"+
+			"  POST /v1/emails           send a single templated email\n"+
+			"  POST /v1/campaigns        start a campaign from an uploaded CSV file\n"+
+			"  GET  /v1/campaigns/{id}   query the status of a campaign\n\n"+
+			"Requests must have an \"Authorization: Bearer <token>\" header, and POST requests\n"+
+			"with an Idempotency-Key header are never sent twice. The campaign options are\n"+
+			"the defaults of the requests.")
+	opts := newCampaignOptions(fs)
+	sender := newSenderOptions(fs)
+	addr := fs.String("addr", "localhost:8080", "Address to listen on")
+	tokenSource := fs.String("token-source", "env:GOPHER_LITE_MAILER_API_TOKEN", "Where to read the API token from: env:NAME, file:PATH (permissions 0600), prompt or keyring[:SERVICE]")
+	telemetry := newTelemetryOptions(fs)
+	fs.Parse(args)
+
+	c, err := opts.campaign()
+	if err != nil {
+		return err
+	}
+
+	source, err := credentials.Parse(*tokenSource)
+	if err != nil {
+		return err
+	}
+	token, err := source.Password("api")
+	if err != nil {
+		return fmt.Errorf("could not get API token from %s: %v", source, err)
+	}
+
+	pool, rateLimit, err := sender.pool(c, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	handler, err := api.NewServer(api.Config{
+		Token:           token,
+		TemplatesRoot:   templatesRoot,
+		Defaults:        c,
+		Sender:          pool,
+		RateLimit:       rateLimit,
+		IdempotencyFile: sender.statePath("idempotency.json"),
+		CampaignsFile:   sender.statePath("campaigns.json"),
+	})
+	if err != nil {
+		return err
+	}
+	defer handler.Close()
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stopTelemetry, err := telemetry.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopTelemetry()
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	slog.Info("🌐 API listening", slog.String("addr", *addr))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+
+	slog.Info("👋 API stopped")
+	return nil
+}
@@ -0,0 +1,334 @@
+package campaign
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/schedule"
+	"github.com/reneepc/gopher-lite-mailer/webhook"
+	"gopkg.in/yaml.v3"
+)
+
+type Campaign struct {
+	Dir         string            `yaml:"dir"`
+	Body        string            `yaml:"body"`
+	Subject     string            `yaml:"subject"`
+	Preheader   string            `yaml:"preheader"`
+	Data        string            `yaml:"data"`
+	Signature   string            `yaml:"signature"`
+	Locale      string            `yaml:"locale"`
+	Strict      bool              `yaml:"strict"`
+	InlineCSS   bool              `yaml:"inline_css"`
+	Sender      Sender            `yaml:"sender"`
+	Attachments []Attachment      `yaml:"attachments"`
+	Headers     map[string]string `yaml:"headers"`
+	RateLimit   RateLimit         `yaml:"rate_limit"`
+	Schedule    Schedule          `yaml:"schedule"`
+	Webhooks    []Webhook         `yaml:"webhooks"`
+	ErrorRate   ErrorRate         `yaml:"error_rate"`
+}
+
+// Sender is either one or more named profiles from the profiles file or an
+// email address of one of the known providers. With several profiles, the
+// emails are distributed across their accounts.
+type Sender struct {
+	Profile  string   `yaml:"profile"`
+	Profiles []string `yaml:"profiles"`
+	Email    string   `yaml:"email"`
+	Provider string   `yaml:"provider"`
+}
+
+// ProfileNames returns every profile of the sender, starting with Profile.
+func (s Sender) ProfileNames() []string {
+	var names []string
+	if s.Profile != "" {
+		names = append(names, s.Profile)
+	}
+	return append(names, s.Profiles...)
+}
+
+type Attachment struct {
+	File         string `yaml:"file"`
+	ContentType  string `yaml:"content_type"`
+	ContentID    string `yaml:"content_id"`
+	Base64Encode bool   `yaml:"base64"`
+}
+
+type RateLimit struct {
+	Interval time.Duration `yaml:"interval"`
+	Burst    int           `yaml:"burst"`
+}
+
+// Schedule holds the schedule settings as written by the user. SendAt is in
+// RFC 3339 format or a wall clock time in Timezone, and Window is a daily
+// period such as "08:00-21:00" outside of which sending pauses.
+type Schedule struct {
+	SendAt   string `yaml:"send_at"`
+	Window   string `yaml:"window"`
+	Timezone string `yaml:"timezone"`
+}
+
+// Webhook is a URL notified of the campaign events. SecretSource, in the
+// format of -password-source, gives the key the requests are signed with, and
+// Events limits the events sent, which defaults to all of them.
+type Webhook struct {
+	URL          string   `yaml:"url"`
+	SecretSource string   `yaml:"secret_source"`
+	Events       []string `yaml:"events"`
+}
+
+// ErrorRate is the share of failed emails, from 0 to 1, over which the
+// webhooks are warned, once at least MinEmails were sent or failed. A zero
+// Threshold disables the warning.
+type ErrorRate struct {
+	Threshold float64 `yaml:"threshold"`
+	MinEmails int     `yaml:"min_emails"`
+}
+
+// Key identifies the campaign by its template and data, e.g. to keep state
+// between runs of the same campaign.
+func (c Campaign) Key() string {
+	return fmt.Sprintf("%s/%s:%s", c.Dir, c.Body, c.Data)
+}
+
+// Default returns the campaign used when no campaign file is given. Its
+// values match the defaults of the command line flags.
+func Default() Campaign {
+	return Campaign{
+		Dir:       "standard",
+		Body:      "workshop-confirmation.html",
+		Data:      "data.csv",
+		Signature: "https://golang.sampa.br/img/golangsp01.png",
+		Sender:    Sender{Provider: "gmail"},
+		Headers:   make(map[string]string),
+		RateLimit: RateLimit{Interval: 2 * time.Second, Burst: 5},
+		ErrorRate: ErrorRate{Threshold: 0.2, MinEmails: 10},
+	}
+}
+
+// TemplateBuilder creates the builder of a body of a directory under root
+// with the signature and template options of the campaign, such as its
+// locale, subject and preheader, so every command renders the same email.
+// The subject and preheader of the body are used when the campaign has none.
+func (c Campaign) TemplateBuilder(root, dir, body string) mailer.EmailTemplateBuilder {
+	builder := mailer.NewEmailTemplateBuilder(path.Join(root, dir), body, c.Signature).
+		WithStrict(c.Strict).
+		WithInlineCSS(c.InlineCSS).
+		WithSubject(c.Subject).
+		WithPreheader(c.Preheader)
+	if c.Locale != "" {
+		builder = builder.WithLocale(c.Locale)
+	}
+	return builder
+}
+
+// Load reads a YAML campaign file. Fields missing from the file keep the
+// values from Default. Unknown fields and invalid values are reported with
+// the line they appear on.
+func Load(path string) (Campaign, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Campaign{}, fmt.Errorf("could not read campaign file: %v", err)
+	}
+
+	c := Default()
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&c); err != nil && !errors.Is(err, io.EOF) {
+		return Campaign{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var root yaml.Node
+	if err := yaml.Unmarshal(content, &root); err != nil {
+		return Campaign{}, fmt.Errorf("%s: %v", path, err)
+	}
+
+	if errs := c.validate(nodeLocator(&root)); len(errs) > 0 {
+		return Campaign{}, wrapErrors(path, errs)
+	}
+
+	return c, nil
+}
+
+// Validate checks the campaign for missing or invalid fields. It is meant for
+// campaigns that were changed after Load, such as by command line flags.
+func (c Campaign) Validate() error {
+	errs := c.validate(func(...string) int { return 0 })
+	if len(errs) > 0 {
+		return wrapErrors("", errs)
+	}
+	return nil
+}
+
+// FieldError describes an invalid campaign field. Line is zero when the field
+// does not come from a campaign file.
+type FieldError struct {
+	Line  int
+	Field string
+	Msg   string
+}
+
+func (e FieldError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", e.Line, e.Field, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Msg)
+}
+
+func (c Campaign) validate(lineOf func(path ...string) int) []error {
+	var errs []error
+	fail := func(msg string, path ...string) {
+		errs = append(errs, FieldError{
+			Line:  lineOf(path...),
+			Field: strings.Join(path, "."),
+			Msg:   msg,
+		})
+	}
+
+	if c.Dir == "" {
+		fail("is required", "dir")
+	}
+	if c.Body == "" {
+		fail("is required", "body")
+	}
+	if c.Data == "" {
+		fail("is required", "data")
+	}
+
+	if c.Sender.Email != "" {
+		if _, err := mail.ParseAddress(c.Sender.Email); err != nil {
+			fail(fmt.Sprintf("invalid address %q", c.Sender.Email), "sender", "email")
+		}
+	}
+	for i, name := range c.Sender.Profiles {
+		if name == "" {
+			fail("must not be empty", "sender", "profiles", fmt.Sprint(i))
+		}
+	}
+	switch c.Sender.Provider {
+	case "gmail", "outlook":
+	default:
+		fail(fmt.Sprintf("unknown provider %q, expected gmail or outlook", c.Sender.Provider), "sender", "provider")
+	}
+
+	for i, attachment := range c.Attachments {
+		index := fmt.Sprint(i)
+		if attachment.File == "" {
+			fail("is required", "attachments", index, "file")
+		}
+		if attachment.ContentType == "" {
+			fail("is required", "attachments", index, "content_type")
+		}
+	}
+
+	for key, value := range c.Headers {
+		if key == "" || strings.ContainsAny(key, ": \t\r\n") {
+			fail(fmt.Sprintf("invalid header name %q", key), "headers", key)
+		}
+		// A line break would end the header and let the value add others.
+		if strings.ContainsAny(value, "\r\n") {
+			fail(fmt.Sprintf("invalid header value %q, line breaks are not allowed", value), "headers", key)
+		}
+	}
+
+	if c.RateLimit.Interval < 0 {
+		fail("must not be negative", "rate_limit", "interval")
+	}
+	if c.RateLimit.Burst < 1 {
+		fail("must be at least 1", "rate_limit", "burst")
+	}
+
+	if c.Schedule.Timezone != "" {
+		if _, err := time.LoadLocation(c.Schedule.Timezone); err != nil {
+			fail(fmt.Sprintf("unknown timezone %q", c.Schedule.Timezone), "schedule", "timezone")
+		}
+	}
+	if c.Schedule.SendAt != "" {
+		if _, err := schedule.ParseTime(c.Schedule.SendAt, time.UTC); err != nil {
+			fail(err.Error(), "schedule", "send_at")
+		}
+	}
+	if c.Schedule.Window != "" {
+		if _, err := schedule.ParseWindow(c.Schedule.Window); err != nil {
+			fail(err.Error(), "schedule", "window")
+		}
+	}
+
+	for i, hook := range c.Webhooks {
+		index := fmt.Sprint(i)
+		if u, err := url.Parse(hook.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			fail(fmt.Sprintf("invalid URL %q, expected an http or https URL", hook.URL), "webhooks", index, "url")
+		}
+		for j, event := range hook.Events {
+			if !slices.Contains(webhook.EventTypes, webhook.EventType(event)) {
+				fail(fmt.Sprintf("unknown event %q, expected one of %v", event, webhook.EventTypes), "webhooks", index, "events", fmt.Sprint(j))
+			}
+		}
+	}
+	if c.ErrorRate.Threshold < 0 || c.ErrorRate.Threshold > 1 {
+		fail("must be between 0 and 1", "error_rate", "threshold")
+	}
+	if c.ErrorRate.MinEmails < 0 {
+		fail("must not be negative", "error_rate", "min_emails")
+	}
+
+	return errs
+}
+
+// nodeLocator returns a function that finds the line of the value at the given
+// path of mapping keys and sequence indexes. When only part of the path is
+// present in the document, it returns the line of the deepest node found, or
+// zero when not even the top level key is present.
+func nodeLocator(root *yaml.Node) func(path ...string) int {
+	return func(path ...string) int {
+		node := root
+		if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+			node = node.Content[0]
+		}
+
+		line := 0
+		for _, key := range path {
+			node = childNode(node, key)
+			if node == nil {
+				break
+			}
+			line = node.Line
+		}
+		return line
+	}
+}
+
+func childNode(node *yaml.Node, key string) *yaml.Node {
+	switch node.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				return node.Content[i+1]
+			}
+		}
+	case yaml.SequenceNode:
+		var index int
+		if _, err := fmt.Sscan(key, &index); err == nil && index >= 0 && index < len(node.Content) {
+			return node.Content[index]
+		}
+	}
+	return nil
+}
+
+func wrapErrors(path string, errs []error) error {
+	err := errors.Join(errs...)
+	if path == "" {
+		return fmt.Errorf("invalid campaign:\n%v", err)
+	}
+	return fmt.Errorf("invalid campaign %s:\n%v", path, err)
+}
@@ -0,0 +1,170 @@
+package campaign_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/campaign"
+)
+
+func createCampaignFile(t *testing.T, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "campaign.yaml")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create campaign file: %v", err)
+	}
+
+	return filePath
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]struct {
+		content       string
+		expectedError string
+		check         func(t *testing.T, c campaign.Campaign)
+	}{
+		"Full Campaign": {
+			content: `dir: standard
+body: workshop-reminder.html
+subject: "Lembrete: Workshop"
+data: reminder.csv
+sender:
+  email: golangsp@gmail.com
+  provider: outlook
+attachments:
+  - file: assets/logo.png
+    content_type: image/png
+    content_id: logo
+    base64: true
+headers:
+  Reply-To: contato@golang.sampa.br
+rate_limit:
+  interval: 3s
+  burst: 2
+schedule:
+  send_at: 2024-08-06T08:00:00-03:00
+  window: 08:00-21:00
+  timezone: America/Sao_Paulo
+`,
+			check: func(t *testing.T, c campaign.Campaign) {
+				if c.Body != "workshop-reminder.html" || c.Subject != "Lembrete: Workshop" || c.Data != "reminder.csv" {
+					t.Errorf("unexpected template fields: %+v", c)
+				}
+				if c.Sender.Provider != "outlook" || c.Sender.Email != "golangsp@gmail.com" {
+					t.Errorf("unexpected sender: %+v", c.Sender)
+				}
+				if len(c.Attachments) != 1 || c.Attachments[0].ContentID != "logo" || !c.Attachments[0].Base64Encode {
+					t.Errorf("unexpected attachments: %+v", c.Attachments)
+				}
+				if c.Headers["Reply-To"] != "contato@golang.sampa.br" {
+					t.Errorf("unexpected headers: %+v", c.Headers)
+				}
+				if c.RateLimit.Interval != 3*time.Second || c.RateLimit.Burst != 2 {
+					t.Errorf("unexpected rate limit: %+v", c.RateLimit)
+				}
+				expectedSchedule := campaign.Schedule{SendAt: "2024-08-06T08:00:00-03:00", Window: "08:00-21:00", Timezone: "America/Sao_Paulo"}
+				if c.Schedule != expectedSchedule {
+					t.Errorf("unexpected schedule: %+v", c.Schedule)
+				}
+			},
+		},
+		"Defaults for Missing Fields": {
+			content: "body: coupon-globoplay.html\n",
+			check: func(t *testing.T, c campaign.Campaign) {
+				defaults := campaign.Default()
+				if c.Dir != defaults.Dir || c.Data != defaults.Data || c.RateLimit != defaults.RateLimit {
+					t.Errorf("expected defaults, got %+v", c)
+				}
+			},
+		},
+		"Empty File": {
+			content: "",
+			check: func(t *testing.T, c campaign.Campaign) {
+				if c.Body != campaign.Default().Body {
+					t.Errorf("expected default body, got %q", c.Body)
+				}
+			},
+		},
+		"Unknown Field": {
+			content:       "dir: standard\nbodyy: typo.html\n",
+			expectedError: "line 2: field bodyy not found",
+		},
+		"Invalid Duration": {
+			content:       "rate_limit:\n  interval: fast\n",
+			expectedError: "line 2",
+		},
+		"Invalid Provider": {
+			content:       "sender:\n  provider: yahoo\n",
+			expectedError: "line 2: sender.provider: unknown provider \"yahoo\"",
+		},
+		"Invalid Burst": {
+			content:       "body: a.html\nrate_limit:\n  burst: 0\n",
+			expectedError: "line 3: rate_limit.burst: must be at least 1",
+		},
+		"Attachment Without File": {
+			content:       "attachments:\n  - content_type: image/png\n",
+			expectedError: "line 2: attachments.0.file: is required",
+		},
+		"Invalid Window": {
+			content:       "schedule:\n  send_at: 2024-08-06 08:00\n  window: 8h-21h\n",
+			expectedError: "line 3: schedule.window: invalid window",
+		},
+		"Unknown Timezone": {
+			content:       "schedule:\n  timezone: America/Campinas\n",
+			expectedError: "line 2: schedule.timezone: unknown timezone",
+		},
+		"Invalid Webhook URL": {
+			content:       "webhooks:\n  - url: chat.example.com/hook\n",
+			expectedError: "line 2: webhooks.0.url: invalid URL",
+		},
+		"Unknown Webhook Event": {
+			content:       "webhooks:\n  - url: https://chat.example.com/hook\n    events: [campaign.finished, campaign.paused]\n",
+			expectedError: "line 3: webhooks.0.events.1: unknown event \"campaign.paused\"",
+		},
+		"Header Value With Line Break": {
+			content:       "headers:\n  X-Campaign: \"golang-sp\\r\\nBcc: all@example.com\"\n",
+			expectedError: "line 2: headers.X-Campaign: invalid header value",
+		},
+		"Empty Required Field": {
+			content:       "body: \"\"\n",
+			expectedError: "line 1: body: is required",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			c, err := campaign.Load(createCampaignFile(t, tt.content))
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			tt.check(t, c)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	c := campaign.Default()
+	if err := c.Validate(); err != nil {
+		t.Fatalf("expected default campaign to be valid, got %v", err)
+	}
+
+	c.Body = ""
+	err := c.Validate()
+	if err == nil || !strings.Contains(err.Error(), "body: is required") {
+		t.Fatalf("expected missing body error, got %v", err)
+	}
+	if strings.Contains(err.Error(), "line") {
+		t.Errorf("expected no line number outside of a campaign file, got %v", err)
+	}
+}
@@ -0,0 +1,169 @@
+package credentials
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+	"golang.org/x/term"
+)
+
+// KeyringService is the service name used to look up passwords in the OS
+// keyring when none is given.
+const KeyringService = "gopher-lite-mailer"
+
+// Source provides the password of a sender account. Implementations never
+// include the password in their errors or in their String output, so both
+// are safe to log.
+type Source interface {
+	Password(account string) (string, error)
+	String() string
+}
+
+// Parse creates a Source from its flag representation:
+//
+//	env:NAME        environment variable NAME
+//	file:PATH       first line of PATH, which must not be readable by others
+//	prompt          interactive prompt without echo
+//	keyring         OS keyring, under the default service name
+//	keyring:SERVICE OS keyring, under the given service name
+func Parse(value string) (Source, error) {
+	kind, arg, _ := strings.Cut(value, ":")
+	switch kind {
+	case "env":
+		if arg == "" {
+			return nil, fmt.Errorf("env source requires a variable name, e.g. env:APP_PASS")
+		}
+		return EnvSource{Name: arg}, nil
+	case "file":
+		if arg == "" {
+			return nil, fmt.Errorf("file source requires a path, e.g. file:~/.gopher-lite-mailer/password")
+		}
+		return FileSource{Path: arg}, nil
+	case "prompt":
+		return PromptSource{In: os.Stdin, Out: os.Stderr}, nil
+	case "keyring":
+		if arg == "" {
+			arg = KeyringService
+		}
+		return KeyringSource{Service: arg}, nil
+	default:
+		return nil, fmt.Errorf("unknown password source %q, expected env:NAME, file:PATH, prompt or keyring[:SERVICE]", value)
+	}
+}
+
+type EnvSource struct {
+	Name string
+}
+
+func (s EnvSource) Password(string) (string, error) {
+	password, ok := os.LookupEnv(s.Name)
+	if !ok || password == "" {
+		return "", fmt.Errorf("environment variable %s is not set", s.Name)
+	}
+	return password, nil
+}
+
+func (s EnvSource) String() string {
+	return "env:" + s.Name
+}
+
+type FileSource struct {
+	Path string
+}
+
+// Password reads the first line of the file. The file is rejected when its
+// permissions allow anyone other than the owner to read or write it.
+func (s FileSource) Password(string) (string, error) {
+	path := expandHome(s.Path)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("could not stat password file: %v", err)
+	}
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		return "", fmt.Errorf("password file %s has permissions %#o, expected 0600", s.Path, perm)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("could not read password file: %v", err)
+	}
+
+	password, _, _ := strings.Cut(string(content), "\n")
+	password = strings.TrimRight(password, "\r")
+	if password == "" {
+		return "", fmt.Errorf("password file %s is empty", s.Path)
+	}
+	return password, nil
+}
+
+func (s FileSource) String() string {
+	return "file:" + s.Path
+}
+
+type PromptSource struct {
+	In  *os.File
+	Out io.Writer
+}
+
+// Password asks for the password on the terminal without echoing it.
+func (s PromptSource) Password(account string) (string, error) {
+	fd := int(s.In.Fd())
+	if !term.IsTerminal(fd) {
+		return "", fmt.Errorf("cannot prompt for password: standard input is not a terminal")
+	}
+
+	fmt.Fprintf(s.Out, "Password for %s: ", account)
+	password, err := term.ReadPassword(fd)
+	fmt.Fprintln(s.Out)
+	if err != nil {
+		return "", fmt.Errorf("could not read password: %v", err)
+	}
+	if len(password) == 0 {
+		return "", fmt.Errorf("empty password")
+	}
+	return string(password), nil
+}
+
+func (s PromptSource) String() string {
+	return "prompt"
+}
+
+// KeyringSource reads the password from the OS keyring, which is the Secret
+// Service D-Bus API on Linux, the Keychain on macOS and the Credential Manager
+// on Windows. Passwords are stored under the service name and the account
+// email, e.g. with secret-tool:
+//
+//	secret-tool store --label="Gopher Lite Mailer" service gopher-lite-mailer username you@gmail.com
+type KeyringSource struct {
+	Service string
+}
+
+func (s KeyringSource) Password(account string) (string, error) {
+	password, err := keyring.Get(s.Service, account)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", fmt.Errorf("no password for %s in keyring service %s", account, s.Service)
+	}
+	if err != nil {
+		return "", fmt.Errorf("could not read keyring: %v", err)
+	}
+	return password, nil
+}
+
+func (s KeyringSource) String() string {
+	return "keyring:" + s.Service
+}
+
+func expandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
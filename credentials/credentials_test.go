@@ -0,0 +1,130 @@
+package credentials_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/credentials"
+	"github.com/zalando/go-keyring"
+)
+
+func TestParse(t *testing.T) {
+	tests := map[string]struct {
+		value       string
+		expected    string
+		expectError bool
+	}{
+		"Env":               {value: "env:APP_PASS", expected: "env:APP_PASS"},
+		"File":              {value: "file:/tmp/pass", expected: "file:/tmp/pass"},
+		"Prompt":            {value: "prompt", expected: "prompt"},
+		"Default Keyring":   {value: "keyring", expected: "keyring:gopher-lite-mailer"},
+		"Custom Keyring":    {value: "keyring:golangsp", expected: "keyring:golangsp"},
+		"Env Without Name":  {value: "env", expectError: true},
+		"File Without Path": {value: "file:", expectError: true},
+		"Unknown":           {value: "argv", expectError: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			source, err := credentials.Parse(tt.value)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error = %v, got %v", tt.expectError, err)
+			}
+			if err == nil && source.String() != tt.expected {
+				t.Errorf("expected source %q, got %q", tt.expected, source.String())
+			}
+		})
+	}
+}
+
+func TestEnvSource(t *testing.T) {
+	t.Setenv("GOPHER_TEST_PASS", "s3cret")
+
+	password, err := credentials.EnvSource{Name: "GOPHER_TEST_PASS"}.Password("user@gmail.com")
+	if err != nil || password != "s3cret" {
+		t.Errorf("expected password s3cret, got %q (error %v)", password, err)
+	}
+
+	_, err = credentials.EnvSource{Name: "GOPHER_TEST_UNSET"}.Password("user@gmail.com")
+	if err == nil {
+		t.Errorf("expected error for unset variable")
+	}
+}
+
+func TestFileSource(t *testing.T) {
+	tests := map[string]struct {
+		content     string
+		perm        os.FileMode
+		expected    string
+		expectError bool
+	}{
+		"Owner Only":           {content: "s3cret\n", perm: 0600, expected: "s3cret"},
+		"Read Only":            {content: "s3cret", perm: 0400, expected: "s3cret"},
+		"Windows Line Ending":  {content: "s3cret\r\nignored\r\n", perm: 0600, expected: "s3cret"},
+		"Readable by Group":    {content: "s3cret\n", perm: 0640, expectError: true},
+		"Readable by Everyone": {content: "s3cret\n", perm: 0644, expectError: true},
+		"Empty":                {content: "\n", perm: 0600, expectError: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "password")
+			if err := os.WriteFile(path, []byte(tt.content), tt.perm); err != nil {
+				t.Fatalf("Failed to create password file: %v", err)
+			}
+			if err := os.Chmod(path, tt.perm); err != nil {
+				t.Fatalf("Failed to change permissions: %v", err)
+			}
+
+			password, err := credentials.FileSource{Path: path}.Password("user@gmail.com")
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error = %v, got %v", tt.expectError, err)
+			}
+			if password != tt.expected {
+				t.Errorf("expected password %q, got %q", tt.expected, password)
+			}
+			if err != nil && strings.Contains(err.Error(), "s3cret") {
+				t.Errorf("error leaks the password: %v", err)
+			}
+		})
+	}
+}
+
+func TestKeyringSource(t *testing.T) {
+	// Replaces the Secret Service D-Bus backend with an in-memory stand-in, so
+	// the test runs without a session bus. TestKeyringSourceSecretService, in
+	// the secretservice build tag, runs against a real one.
+	keyring.MockInit()
+
+	if err := keyring.Set("golangsp", "user@gmail.com", "s3cret"); err != nil {
+		t.Fatalf("Failed to store password: %v", err)
+	}
+
+	source := credentials.KeyringSource{Service: "golangsp"}
+
+	password, err := source.Password("user@gmail.com")
+	if err != nil || password != "s3cret" {
+		t.Errorf("expected password s3cret, got %q (error %v)", password, err)
+	}
+
+	_, err = source.Password("other@gmail.com")
+	if err == nil {
+		t.Errorf("expected error for unknown account")
+	}
+}
+
+func TestPromptSourceRequiresTerminal(t *testing.T) {
+	in, err := os.CreateTemp(t.TempDir(), "stdin")
+	if err != nil {
+		t.Fatalf("Failed to create input file: %v", err)
+	}
+	defer in.Close()
+
+	var out strings.Builder
+	_, err = credentials.PromptSource{In: in, Out: &out}.Password("user@gmail.com")
+	if err == nil {
+		t.Errorf("expected error when input is not a terminal")
+	}
+}
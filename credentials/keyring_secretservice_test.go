@@ -0,0 +1,44 @@
+//go:build secretservice
+
+package credentials_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/credentials"
+	"github.com/zalando/go-keyring"
+)
+
+// TestKeyringSourceSecretService reads a password through the Secret Service
+// D-Bus API instead of the in-memory keyring of TestKeyringSource. It needs a
+// session bus with an unlocked Secret Service, such as a throwaway GNOME
+// Keyring:
+//
+//	dbus-run-session -- sh -c 'echo -n test | gnome-keyring-daemon --unlock --components=secrets >/dev/null &&
+//		go test -tags secretservice -run SecretService ./credentials'
+func TestKeyringSourceSecretService(t *testing.T) {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		t.Skip("no D-Bus session bus, run the test with dbus-run-session")
+	}
+
+	const service = "gopher-lite-mailer-test"
+	if err := keyring.Set(service, "user@gmail.com", "s3cret"); err != nil {
+		t.Skipf("Secret Service unavailable: %v", err)
+	}
+	t.Cleanup(func() {
+		keyring.Delete(service, "user@gmail.com")
+	})
+
+	source := credentials.KeyringSource{Service: service}
+
+	password, err := source.Password("user@gmail.com")
+	if err != nil || password != "s3cret" {
+		t.Errorf("expected password s3cret, got %q (error %v)", password, err)
+	}
+
+	_, err = source.Password("other@gmail.com")
+	if err == nil {
+		t.Errorf("expected error for unknown account")
+	}
+}
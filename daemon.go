@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/campaign"
+	"github.com/reneepc/gopher-lite-mailer/logging"
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/metrics"
+	"github.com/reneepc/gopher-lite-mailer/spool"
+	"golang.org/x/time/rate"
+)
+
+func runDaemon(args []string) error {
+	fs := newFlagSet("daemon", "[email]",
+		"Watches a spool directory for job files and sends them. Each job is a JSON file\n"+
+			"written to the \"new\" subdirectory, such as:\n\n"+
+			"  {\"to\": \"gopher@example.com\", \"body\": \"workshop-confirmation.html\",\n"+
+			"   \"subject\": \"Confirmação\", \"data\": {\"Nome\": \"Gopher\"}}\n\n"+
+			"Only files ending in .json are read, so write the job to a temporary name and\n"+
+			"rename it when complete. Sent jobs are moved to \"done\" and failed ones to \"failed\".\n"+
+			"The campaign options are the defaults of the jobs.")
+	opts := newCampaignOptions(fs)
+	sender := newSenderOptions(fs)
+	spoolDir := fs.String("spool", filepath.Join(defaultStateDir, "spool"), "Spool directory to watch")
+	pollInterval := fs.Duration("poll-interval", 2*time.Second, "How often the spool directory is checked for new jobs")
+	telemetry := newTelemetryOptions(fs)
+	fs.Parse(args)
+
+	c, err := opts.campaign()
+	if err != nil {
+		return err
+	}
+
+	pool, rateLimit, err := sender.pool(c, fs.Args())
+	if err != nil {
+		return err
+	}
+
+	s, err := spool.Open(*spoolDir)
+	if err != nil {
+		return err
+	}
+
+	requeued, interrupted, err := s.Recover()
+	if err != nil {
+		return err
+	}
+	if len(requeued) > 0 {
+		slog.Warn("♻️ Jobs interrupted by the previous run were queued again", slog.Int("count", len(requeued)))
+	}
+	for _, name := range interrupted {
+		slog.Error("❌ Job interrupted while being sent was moved to failed, since it may have been delivered", slog.String("job", name))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	stopTelemetry, err := telemetry.start(ctx)
+	if err != nil {
+		return err
+	}
+	defer stopTelemetry()
+
+	d := &daemon{
+		spool:    s,
+		pool:     pool,
+		campaign: c,
+		limiter:  newLimiter(rateLimit),
+	}
+
+	slog.Info("📬 Watching spool directory", slog.String("spool", *spoolDir))
+	for {
+		wait := *pollInterval
+		if retryAt := d.processPending(ctx); retryAt.After(time.Now()) {
+			wait = time.Until(retryAt)
+		}
+
+		select {
+		case <-ctx.Done():
+			slog.Info("👋 Daemon stopped")
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+type daemon struct {
+	spool    *spool.Spool
+	pool     *mailer.Pool
+	campaign campaign.Campaign
+	limiter  *rate.Limiter
+}
+
+// processPending sends every job waiting in the spool. When every account
+// reached its daily quota it stops and returns the time the quota frees up.
+func (d *daemon) processPending(ctx context.Context) time.Time {
+	names, err := d.spool.Pending()
+	if err != nil {
+		slog.Error("could not list pending jobs", slog.Any("error", err))
+		return time.Time{}
+	}
+
+	defer func() { metrics.QueueDepth.Set(0) }()
+	for i, name := range names {
+		if ctx.Err() != nil {
+			return time.Time{}
+		}
+		metrics.QueueDepth.Set(float64(len(names) - i))
+
+		job, err := d.spool.Claim(name)
+		if err != nil {
+			slog.Error("❌ Could not read job", slog.String("job", name), slog.Any("error", err))
+			continue
+		}
+
+		if err := metrics.WaitRateLimit(ctx, d.limiter); err != nil {
+			d.release(name)
+			return time.Time{}
+		}
+
+		account, err := d.send(ctx, name, job)
+
+		var quotaErr *mailer.QuotaError
+		if errors.As(err, &quotaErr) {
+			slog.Warn("⏸️ Daily quota reached, pausing until it frees up", slog.String("job", name), slog.Time("resume_at", quotaErr.RetryAt))
+			d.release(name)
+			return quotaErr.RetryAt
+		}
+
+		if err != nil {
+			slog.Error("❌ Could not send email", slog.String("job", name), slog.String(logging.KeyRecipient, job.To), slog.String(logging.KeyAccount, account), slog.Any("error", err))
+			if err := d.spool.Fail(name, err); err != nil {
+				slog.Error("could not move job to failed", slog.String("job", name), slog.Any("error", err))
+			}
+			continue
+		}
+
+		slog.Info("✅ Email successfully sent", slog.String("job", name), slog.String(logging.KeyRecipient, job.To), slog.String(logging.KeyAccount, account))
+		if err := d.spool.Complete(name); err != nil {
+			slog.Error("could not move job to done, it will be moved to failed on restart", slog.String("job", name), slog.Any("error", err))
+		}
+	}
+
+	return time.Time{}
+}
+
+// send renders the job with its template, falling back to the directory and
+// subject of the campaign and then to the front matter of the body, and sends
+// it. The job is marked as sending right before it is delivered, so a restart
+// does not send it twice.
+func (d *daemon) send(ctx context.Context, name string, job spool.Job) (string, error) {
+	dir := job.Dir
+	if dir == "" {
+		dir = d.campaign.Dir
+	}
+	builder := templateBuilder(d.campaign, dir, job.Body)
+	if job.Subject != "" {
+		builder = builder.WithSubject(job.Subject)
+	}
+
+	template, err := builder.Build()
+	if err != nil {
+		return "", fmt.Errorf("could not create email template: %v", err)
+	}
+
+	email, err := template.Render(ctx, job.Data)
+	if err != nil {
+		return "", fmt.Errorf("could not execute template: %v", err)
+	}
+
+	if err := d.spool.MarkSending(name); err != nil {
+		return "", err
+	}
+	return d.pool.SendEmail(job.To, email)
+}
+
+func (d *daemon) release(name string) {
+	if err := d.spool.Release(name); err != nil {
+		slog.Error("could not queue job again", slog.String("job", name), slog.Any("error", err))
+	}
+}
+
+func newLimiter(rateLimit campaign.RateLimit) *rate.Limiter {
+	limit := rate.Inf
+	if rateLimit.Interval > 0 {
+		limit = rate.Every(rateLimit.Interval)
+	}
+	return rate.NewLimiter(limit, rateLimit.Burst)
+}
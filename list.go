@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path"
+)
+
+func runList(args []string) error {
+	fs := newFlagSet("list", "[dir]",
+		"Lists the template directories under templates/ and the bodies available in each one.\n"+
+			"When a directory is given, only its bodies are listed.")
+	fs.Parse(args)
+
+	var dirs []string
+	if fs.NArg() > 0 {
+		dirs = fs.Args()
+	} else {
+		entries, err := os.ReadDir(templatesRoot)
+		if err != nil {
+			return fmt.Errorf("could not read templates directory: %v", err)
+		}
+		for _, entry := range entries {
+			if entry.IsDir() {
+				dirs = append(dirs, entry.Name())
+			}
+		}
+	}
+
+	for _, dir := range dirs {
+		bodies, err := os.ReadDir(path.Join(templatesRoot, dir, "bodies"))
+		if err != nil {
+			return fmt.Errorf("could not read bodies of %s: %v", dir, err)
+		}
+
+		fmt.Println(dir)
+		for _, body := range bodies {
+			if !body.IsDir() {
+				fmt.Printf("  %s\n", body.Name())
+			}
+		}
+	}
+
+	return nil
+}
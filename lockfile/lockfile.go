@@ -0,0 +1,41 @@
+// Package lockfile serializes the writes of several processes to a state
+// file, such as a send and the daemon recording the same daily quota.
+package lockfile
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Stale is the age after which a lock file is taken over, since a process
+// that was killed while holding it never removes it.
+const Stale = 10 * time.Second
+
+// Lock creates the lock file at path, waiting while another process holds it,
+// and returns the function that removes it.
+func Lock(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("could not create lock directory: %v", err)
+	}
+
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, fmt.Errorf("could not create lock file: %v", err)
+		}
+
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > Stale {
+			os.Remove(path)
+			continue
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,63 @@
+package lockfile_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/lockfile"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "quota.json.lock")
+
+	unlock, err := lockfile.Lock(path)
+	if err != nil {
+		t.Fatalf("Failed to lock: %v", err)
+	}
+
+	locked := make(chan func())
+	go func() {
+		unlock, err := lockfile.Lock(path)
+		if err != nil {
+			t.Errorf("Failed to lock again: %v", err)
+		}
+		locked <- unlock
+	}()
+
+	select {
+	case <-locked:
+		t.Fatal("expected the second lock to wait for the first")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	unlock()
+	select {
+	case unlock := <-locked:
+		unlock()
+	case <-time.After(time.Second):
+		t.Fatal("expected the second lock after the first was released")
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("expected lock file to be removed, got %v", err)
+	}
+}
+
+func TestLock_Stale(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json.lock")
+	if err := os.WriteFile(path, nil, 0600); err != nil {
+		t.Fatalf("Failed to create lock file: %v", err)
+	}
+	old := time.Now().Add(-2 * lockfile.Stale)
+	if err := os.Chtimes(path, old, old); err != nil {
+		t.Fatalf("Failed to age lock file: %v", err)
+	}
+
+	unlock, err := lockfile.Lock(path)
+	if err != nil {
+		t.Fatalf("expected stale lock to be taken over, got %v", err)
+	}
+	unlock()
+}
@@ -0,0 +1,217 @@
+package logging
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+	"sync"
+)
+
+// Attribute keys shared by every log line, so lines about the same email can
+// be found across commands.
+const (
+	KeyCampaign  = "campaign"
+	KeyRecipient = "recipient"
+	KeyMessageID = "message_id"
+	KeySMTPCode  = "smtp_code"
+	KeyAccount   = "account"
+)
+
+// Format is the encoding of the log lines.
+type Format string
+
+const (
+	FormatText Format = "text"
+	FormatJSON Format = "json"
+)
+
+// EmailMode is how the email addresses of the recipients are logged.
+type EmailMode string
+
+const (
+	// EmailsPlain logs the addresses as they are.
+	EmailsPlain EmailMode = "plain"
+	// EmailsMask keeps the first letter and the domain, as in g****@example.com.
+	EmailsMask EmailMode = "mask"
+	// EmailsHash replaces the addresses with a short hash, so the lines about
+	// the same recipient can still be correlated.
+	EmailsHash EmailMode = "hash"
+)
+
+var (
+	mu     sync.Mutex
+	out    = &switchWriter{}
+	format = FormatText
+	emails = EmailsPlain
+	level  slog.LevelVar
+)
+
+// switchWriter writes to a writer that can be replaced, so the loggers
+// derived from the default one follow SetOutput.
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(b []byte) (int, error) {
+	s.mu.Lock()
+	w := s.w
+	s.mu.Unlock()
+	return w.Write(b)
+}
+
+// SetOutput makes slog write to w, with the text format and the info level
+// until they are changed with the other Set functions. It is also used to
+// write through the progress view while a campaign is sent.
+func SetOutput(w io.Writer) {
+	out.mu.Lock()
+	first := out.w == nil
+	out.w = w
+	out.mu.Unlock()
+
+	if first {
+		mu.Lock()
+		defer mu.Unlock()
+		install()
+	}
+}
+
+// SetFormat changes the format to text or json. It has the signature of a
+// flag.Func.
+func SetFormat(value string) error {
+	switch f := Format(value); f {
+	case FormatText, FormatJSON:
+		mu.Lock()
+		defer mu.Unlock()
+		format = f
+		install()
+		return nil
+	}
+	return fmt.Errorf("invalid log format %q, expected text or json", value)
+}
+
+// SetLevel changes the minimum level of the logged lines to debug, info, warn
+// or error. It has the signature of a flag.Func.
+func SetLevel(value string) error {
+	if err := level.UnmarshalText([]byte(value)); err != nil {
+		return fmt.Errorf("invalid log level %q, expected debug, info, warn or error", value)
+	}
+	return nil
+}
+
+// SetEmails changes how the recipient addresses are logged to plain, mask or
+// hash. It has the signature of a flag.Func.
+func SetEmails(value string) error {
+	switch mode := EmailMode(value); mode {
+	case EmailsPlain, EmailsMask, EmailsHash:
+		mu.Lock()
+		defer mu.Unlock()
+		emails = mode
+		install()
+		return nil
+	}
+	return fmt.Errorf("invalid email mode %q, expected plain, mask or hash", value)
+}
+
+// install replaces the default logger. Callers must hold mu.
+func install() {
+	out.mu.Lock()
+	ready := out.w != nil
+	out.mu.Unlock()
+	if !ready {
+		return
+	}
+
+	opts := &slog.HandlerOptions{Level: &level}
+	if emails != EmailsPlain {
+		mode := emails
+		opts.ReplaceAttr = func(groups []string, a slog.Attr) slog.Attr {
+			return redactAttr(a, mode)
+		}
+	}
+
+	var handler slog.Handler
+	if format == FormatJSON {
+		handler = slog.NewJSONHandler(out, opts)
+	} else {
+		handler = slog.NewTextHandler(out, opts)
+	}
+	slog.SetDefault(slog.New(redactMessage{Handler: handler, mode: emails}))
+}
+
+var emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+
+// redactAttr redacts the addresses in the value of an attribute. The sender
+// accounts are kept, since they are not personal data of the recipients.
+func redactAttr(a slog.Attr, mode EmailMode) slog.Attr {
+	if a.Key == KeyAccount {
+		return a
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, Redact(a.Value.String(), mode))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, Redact(err.Error(), mode))
+		}
+	}
+	return a
+}
+
+// redactMessage redacts the addresses in the message of the records, which
+// ReplaceAttr does not see.
+type redactMessage struct {
+	slog.Handler
+	mode EmailMode
+}
+
+func (h redactMessage) Handle(ctx context.Context, r slog.Record) error {
+	if h.mode != EmailsPlain {
+		r.Message = Redact(r.Message, h.mode)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h redactMessage) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return redactMessage{Handler: h.Handler.WithAttrs(attrs), mode: h.mode}
+}
+
+func (h redactMessage) WithGroup(name string) slog.Handler {
+	return redactMessage{Handler: h.Handler.WithGroup(name), mode: h.mode}
+}
+
+// RedactEmails redacts the email addresses in s like the log lines, for the
+// output written without the logger.
+func RedactEmails(s string) string {
+	mu.Lock()
+	mode := emails
+	mu.Unlock()
+	return Redact(s, mode)
+}
+
+// Redact masks or hashes every email address in s.
+func Redact(s string, mode EmailMode) string {
+	if mode == EmailsPlain {
+		return s
+	}
+	return emailPattern.ReplaceAllStringFunc(s, func(address string) string {
+		return redactEmail(address, mode)
+	})
+}
+
+func redactEmail(address string, mode EmailMode) string {
+	if mode == EmailsHash {
+		sum := sha256.Sum256([]byte(strings.ToLower(address)))
+		return "sha256:" + hex.EncodeToString(sum[:6])
+	}
+
+	local, domain, _ := strings.Cut(address, "@")
+	first := []rune(local)[0]
+	return string(first) + strings.Repeat("*", 4) + "@" + domain
+}
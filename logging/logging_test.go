@@ -0,0 +1,105 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/logging"
+)
+
+func TestRedact(t *testing.T) {
+	tests := map[string]struct {
+		input    string
+		mode     logging.EmailMode
+		expected string
+	}{
+		"Plain": {
+			input:    "gopher@example.com",
+			mode:     logging.EmailsPlain,
+			expected: "gopher@example.com",
+		},
+		"Mask": {
+			input:    "gopher@example.com",
+			mode:     logging.EmailsMask,
+			expected: "g****@example.com",
+		},
+		"Mask Inside Error": {
+			input:    "550 5.1.1 <ferris.crab@example.com>: No such user",
+			mode:     logging.EmailsMask,
+			expected: "550 5.1.1 <f****@example.com>: No such user",
+		},
+		"Hash Ignores Case": {
+			input:    "Gopher@Example.com",
+			mode:     logging.EmailsHash,
+			expected: logging.Redact("gopher@example.com", logging.EmailsHash),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := logging.Redact(tt.input, tt.mode); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	if hash := logging.Redact("gopher@example.com", logging.EmailsHash); !strings.HasPrefix(hash, "sha256:") || strings.Contains(hash, "gopher") {
+		t.Errorf("expected a hash, got %q", hash)
+	}
+}
+
+func TestSetOutput(t *testing.T) {
+	var out bytes.Buffer
+	logging.SetOutput(&out)
+	t.Cleanup(func() {
+		logging.SetFormat("text")
+		logging.SetLevel("info")
+		logging.SetEmails("plain")
+		logging.SetOutput(os.Stderr)
+	})
+
+	for _, set := range []func() error{
+		func() error { return logging.SetFormat("json") },
+		func() error { return logging.SetLevel("warn") },
+		func() error { return logging.SetEmails("mask") },
+	} {
+		if err := set(); err != nil {
+			t.Fatalf("Failed to configure logging: %v", err)
+		}
+	}
+	if err := logging.SetFormat("xml"); err == nil {
+		t.Error("expected invalid format error")
+	}
+
+	slog.Info("not logged below warn")
+	slog.Warn("could not send to gopher@example.com",
+		slog.String(logging.KeyRecipient, "gopher@example.com"),
+		slog.String(logging.KeyAccount, "golangsp@example.com"),
+		slog.Any("error", errors.New("550 <gopher@example.com> unknown")))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("expected 1 line, got %q", out.String())
+	}
+
+	var line map[string]any
+	if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+		t.Fatalf("expected a JSON line, got %q", lines[0])
+	}
+	expected := map[string]any{
+		"msg":                "could not send to g****@example.com",
+		logging.KeyRecipient: "g****@example.com",
+		logging.KeyAccount:   "golangsp@example.com",
+		"error":              "550 <g****@example.com> unknown",
+	}
+	for key, value := range expected {
+		if line[key] != value {
+			t.Errorf("expected %s = %q, got %q", key, value, line[key])
+		}
+	}
+}
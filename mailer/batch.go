@@ -0,0 +1,290 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"net/textproto"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/reneepc/gopher-lite-mailer/logging"
+	"github.com/reneepc/gopher-lite-mailer/metrics"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+	"github.com/reneepc/gopher-lite-mailer/tracing"
+)
+
+// Status is the outcome of the email of a record in a batch.
+type Status string
+
+const (
+	// StatusSent means the server accepted the email.
+	StatusSent Status = "sent"
+	// StatusFailed means the email could not be rendered or the server
+	// rejected it.
+	StatusFailed Status = "failed"
+	// StatusSkipped means the email was not attempted, because the batch was
+	// cancelled or every account reached its daily quota.
+	StatusSkipped Status = "skipped"
+)
+
+// RecordResult is the outcome of the email of one record of a batch.
+type RecordResult struct {
+	// Index is the position of the record in the batch.
+	Index   int
+	Record  parser.MailRecord
+	Status  Status
+	Account string
+	// MessageID is the Message-ID header of a sent email.
+	MessageID string
+	// Attempts is the number of times the email was sent to the server.
+	Attempts int
+	// Code and Response are the SMTP reply to the email, either the success
+	// or the rejection one. They are empty when the server did not reply,
+	// such as on connection errors.
+	Code     int
+	Response string
+	Err      error
+	// StartedAt is when the email started to be rendered and sent, and
+	// Duration how long it took including the retries.
+	StartedAt time.Time
+	Duration  time.Duration
+}
+
+// BatchOptions configures Pool.SendBatch.
+type BatchOptions struct {
+	// Subject is used when the template has no subject.
+	Subject string
+	// Concurrency is the number of emails sent at the same time. It defaults
+	// to 10.
+	Concurrency int
+	// MaxAttempts is the number of times an email is tried when the error is
+	// temporary, such as a connection error or a 4xx reply. It defaults to 1.
+	MaxAttempts int
+	// RetryDelay is the wait before the second attempt, doubled for each
+	// following one. It defaults to 5 seconds.
+	RetryDelay time.Duration
+	// Wait, when set, is called before sending each email, e.g. to apply a rate
+	// limit or a schedule. When it returns an error the record is skipped.
+	Wait func(ctx context.Context, record parser.MailRecord) error
+	// WaitForQuota pauses the batch until the daily quota frees up instead of
+	// skipping the remaining records when every account reached it.
+	WaitForQuota bool
+}
+
+// SendBatch renders the template with the data of each record and sends it to
+// the record's email through the pool. A result is sent on the returned
+// channel as soon as each email is done, and the channel is closed when every
+// record has a result. When every account reaches its daily quota, the records
+// not sent yet are skipped with a *QuotaError, unless WaitForQuota is set.
+func (p *Pool) SendBatch(ctx context.Context, template EmailTemplate, records []parser.MailRecord, opts BatchOptions) <-chan RecordResult {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 10
+	}
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 1
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = 5 * time.Second
+	}
+
+	metrics.QueueDepth.Add(float64(len(records)))
+	results := make(chan RecordResult, len(records))
+	indexes := make(chan int)
+	stop := newBatchStop()
+
+	var wg sync.WaitGroup
+	for range min(opts.Concurrency, max(len(records), 1)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				result := p.sendRecord(ctx, stop, template, i, records[i], opts)
+				metrics.QueueDepth.Dec()
+				results <- result
+			}
+		}()
+	}
+
+	go func() {
+		defer close(results)
+		defer wg.Wait()
+		defer close(indexes)
+
+		for i := range records {
+			select {
+			case indexes <- i:
+				continue
+			case <-stop.done:
+			}
+			// The records not dispatched yet are skipped, while the ones
+			// being sent finish on their own.
+			for j := i; j < len(records); j++ {
+				metrics.QueueDepth.Dec()
+				results <- RecordResult{Index: j, Record: records[j], Status: StatusSkipped, Err: stop.cause}
+			}
+			return
+		}
+	}()
+
+	return results
+}
+
+// batchStop stops dispatching the records of a batch. Unlike cancelling the
+// context of the batch, it does not interrupt the emails already being sent.
+type batchStop struct {
+	once  sync.Once
+	done  chan struct{}
+	cause error
+}
+
+func newBatchStop() *batchStop {
+	return &batchStop{done: make(chan struct{})}
+}
+
+func (s *batchStop) stop(cause error) {
+	s.once.Do(func() {
+		s.cause = cause
+		close(s.done)
+	})
+}
+
+// err returns the cause of the stop, or nil when the batch was not stopped.
+func (s *batchStop) err() error {
+	select {
+	case <-s.done:
+		return s.cause
+	default:
+		return nil
+	}
+}
+
+// sendRecord sends the email of a record, retrying temporary errors. It stops
+// the batch when every account reached its quota.
+func (p *Pool) sendRecord(ctx context.Context, stop *batchStop, template EmailTemplate, index int, record parser.MailRecord, opts BatchOptions) (result RecordResult) {
+	result = RecordResult{Index: index, Record: record}
+	skip := func(err error) RecordResult {
+		result.Status = StatusSkipped
+		result.Err = err
+		return result
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "recipient", trace.WithAttributes(attribute.Int("recipient.index", index)))
+	defer func() {
+		span.SetAttributes(
+			attribute.String("status", string(result.Status)),
+			attribute.Int("attempts", result.Attempts),
+			attribute.String("account", result.Account),
+		)
+		tracing.End(span, result.Err)
+	}()
+
+	if ctx.Err() != nil {
+		return skip(context.Cause(ctx))
+	}
+	if err := stop.err(); err != nil {
+		return skip(err)
+	}
+	if opts.Wait != nil {
+		if err := opts.Wait(ctx, record); err != nil {
+			if ctx.Err() != nil {
+				return skip(context.Cause(ctx))
+			}
+			return skip(err)
+		}
+		if err := stop.err(); err != nil {
+			return skip(err)
+		}
+	}
+
+	result.StartedAt = time.Now()
+	defer func() { result.Duration = time.Since(result.StartedAt) }()
+
+	email, err := template.Render(ctx, record.Data)
+	if err != nil {
+		result.Status = StatusFailed
+		result.Err = err
+		return result
+	}
+	if email.Subject == "" {
+		email.Subject = opts.Subject
+	}
+
+	for {
+		result.Attempts++
+		account, sent, err := p.send(ctx, record.Email, email)
+		result.Account = account
+
+		var quotaErr *QuotaError
+		if errors.As(err, &quotaErr) {
+			// Reaching the quota is not an attempt, since nothing was sent.
+			result.Attempts--
+			if opts.WaitForQuota && !quotaErr.RetryAt.IsZero() {
+				slog.Warn("⏸️ Daily quota reached, pausing until it frees up", slog.String(logging.KeyRecipient, record.Email), slog.Time("resume_at", quotaErr.RetryAt))
+				if sleep(ctx, time.Until(quotaErr.RetryAt)) {
+					continue
+				}
+				return skip(context.Cause(ctx))
+			}
+			stop.stop(quotaErr)
+			return skip(quotaErr)
+		}
+
+		if err == nil {
+			result.Status = StatusSent
+			result.Err = nil
+			result.MessageID = sent.MessageID
+			result.Code = sent.Code
+			result.Response = sent.Response
+			return result
+		}
+
+		result.Status = StatusFailed
+		result.Err = err
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) {
+			result.Code = smtpErr.Code
+			result.Response = smtpErr.Msg
+		}
+
+		if result.Attempts >= opts.MaxAttempts || !isTemporary(err) {
+			return result
+		}
+		if !sleep(ctx, opts.RetryDelay<<(result.Attempts-1)) {
+			return result
+		}
+	}
+}
+
+// isTemporary reports whether sending again may succeed: the server replied
+// with a 4xx code or could not be reached.
+func isTemporary(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var smtpErr *textproto.Error
+	if errors.As(err, &smtpErr) {
+		return smtpErr.Code >= 400 && smtpErr.Code < 500
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// sleep waits for d and reports whether it was not interrupted by the context.
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -0,0 +1,225 @@
+package mailer_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace/noop"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+)
+
+func newTestTemplate(t *testing.T) mailer.EmailTemplate {
+	t.Helper()
+
+	dir := t.TempDir()
+	createTempFile(t, dir, "header.html", "<html>")
+	createTempFile(t, dir, "footer.html", "</html>")
+	createTempFile(t, filepath.Join(dir, "bodies"), "hello.html", "<p>Olá, {{ .Data.Nome }}!</p>")
+
+	template, err := mailer.NewEmailTemplate(dir, "hello.html", "")
+	if err != nil {
+		t.Fatalf("Failed to create template: %v", err)
+	}
+	return template
+}
+
+func newTestRecords(emails ...string) []parser.MailRecord {
+	records := make([]parser.MailRecord, len(emails))
+	for i, email := range emails {
+		records[i] = parser.MailRecord{Email: email, Data: map[string]string{"Nome": "Gopher"}}
+	}
+	return records
+}
+
+func collectResults(results <-chan mailer.RecordResult) map[string]mailer.RecordResult {
+	byEmail := make(map[string]mailer.RecordResult)
+	for result := range results {
+		byEmail[result.Record.Email] = result
+	}
+	return byEmail
+}
+
+func TestPool_SendBatch(t *testing.T) {
+	tests := map[string]struct {
+		rcptReplies []string
+		rcptReply   string
+		maxAttempts int
+		expected    mailer.RecordResult
+	}{
+		"Sent": {
+			expected: mailer.RecordResult{Status: mailer.StatusSent, Attempts: 1, Code: 250},
+		},
+		"Temporary Error Retried": {
+			rcptReplies: []string{"451 4.3.0 Try again later"},
+			maxAttempts: 3,
+			expected:    mailer.RecordResult{Status: mailer.StatusSent, Attempts: 2, Code: 250},
+		},
+		"Temporary Error Without Retries": {
+			rcptReplies: []string{"451 4.3.0 Try again later"},
+			expected:    mailer.RecordResult{Status: mailer.StatusFailed, Attempts: 1, Code: 451},
+		},
+		"Permanent Error Not Retried": {
+			rcptReply:   "550 5.1.1 No such user",
+			maxAttempts: 3,
+			expected:    mailer.RecordResult{Status: mailer.StatusFailed, Attempts: 1, Code: 550},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newFakeSMTPServer(t)
+			server.rcptReplies = tt.rcptReplies
+			server.rcptReply = tt.rcptReply
+			pool := mailer.NewPool(newTestAccount(t, "golangsp", server, 0))
+
+			results := pool.SendBatch(context.Background(), newTestTemplate(t), newTestRecords("gopher@example.com"), mailer.BatchOptions{
+				Subject:     "Olá",
+				MaxAttempts: tt.maxAttempts,
+				RetryDelay:  time.Millisecond,
+			})
+			result := collectResults(results)["gopher@example.com"]
+
+			if result.Status != tt.expected.Status || result.Attempts != tt.expected.Attempts || result.Code != tt.expected.Code {
+				t.Errorf("expected %s after %d attempts with code %d, got %s after %d attempts with code %d (%v)",
+					tt.expected.Status, tt.expected.Attempts, tt.expected.Code, result.Status, result.Attempts, result.Code, result.Err)
+			}
+			if result.Duration <= 0 {
+				t.Errorf("expected the duration of the send, got %v", result.Duration)
+			}
+			if (result.Status == mailer.StatusSent) != (result.MessageID != "") {
+				t.Errorf("expected a message id only for sent emails, got %q", result.MessageID)
+			}
+			if (result.Status == mailer.StatusFailed) != (result.Err != nil) {
+				t.Errorf("expected an error only for failed emails, got %v", result.Err)
+			}
+		})
+	}
+}
+
+func TestPool_SendBatchStopsOnQuota(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	pool := mailer.NewPool(newTestAccount(t, "golangsp", server, 2))
+
+	records := newTestRecords("a@example.com", "b@example.com", "c@example.com", "d@example.com")
+	results := collectResults(pool.SendBatch(context.Background(), newTestTemplate(t), records, mailer.BatchOptions{
+		Subject:     "Olá",
+		Concurrency: 1,
+	}))
+
+	if len(results) != len(records) {
+		t.Fatalf("expected a result per record, got %d", len(results))
+	}
+
+	statuses := make(map[mailer.Status]int)
+	for _, result := range results {
+		statuses[result.Status]++
+		if result.Status == mailer.StatusSkipped && !errors.Is(result.Err, mailer.ErrNoAccountAvailable) {
+			t.Errorf("expected skipped records to have the quota error, got %v", result.Err)
+		}
+	}
+	if statuses[mailer.StatusSent] != 2 || statuses[mailer.StatusSkipped] != 2 {
+		t.Errorf("expected 2 sent and 2 skipped, got %v", statuses)
+	}
+	if server.messageCount() != 2 {
+		t.Errorf("expected 2 messages on the server, got %d", server.messageCount())
+	}
+}
+
+func TestPool_SendBatchQuotaKeepsSendsInFlight(t *testing.T) {
+	// The first email is held by the server until the quota stopped the batch.
+	release := make(chan struct{})
+	server := newFakeSMTPServer(t)
+	server.onData = func() { <-release }
+	pool := mailer.NewPool(newTestAccount(t, "golangsp", server, 1))
+
+	records := newTestRecords("a@example.com", "b@example.com", "c@example.com")
+	results := pool.SendBatch(context.Background(), newTestTemplate(t), records, mailer.BatchOptions{
+		Subject:     "Olá",
+		Concurrency: 2,
+	})
+
+	statuses := make(map[mailer.Status]int)
+	for result := range results {
+		statuses[result.Status]++
+		if result.Status == mailer.StatusSkipped && statuses[mailer.StatusSkipped] == 1 {
+			close(release)
+		}
+		if result.Status == mailer.StatusFailed {
+			t.Errorf("expected the email in flight to be sent, got %v", result.Err)
+		}
+	}
+
+	if statuses[mailer.StatusSent] != 1 || statuses[mailer.StatusSkipped] != 2 {
+		t.Errorf("expected 1 sent and 2 skipped, got %v", statuses)
+	}
+	if server.messageCount() != 1 {
+		t.Errorf("expected 1 message on the server, got %d", server.messageCount())
+	}
+}
+
+func TestPool_SendBatchWait(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	pool := mailer.NewPool(newTestAccount(t, "golangsp", server, 0))
+
+	errOutsideWindow := errors.New("outside of the sending window")
+	results := collectResults(pool.SendBatch(context.Background(), newTestTemplate(t), newTestRecords("a@example.com", "b@example.com"), mailer.BatchOptions{
+		Subject: "Olá",
+		Wait: func(ctx context.Context, record parser.MailRecord) error {
+			if record.Email == "b@example.com" {
+				return errOutsideWindow
+			}
+			return nil
+		},
+	}))
+
+	if results["a@example.com"].Status != mailer.StatusSent {
+		t.Errorf("expected a@example.com to be sent, got %+v", results["a@example.com"])
+	}
+	if b := results["b@example.com"]; b.Status != mailer.StatusSkipped || !errors.Is(b.Err, errOutsideWindow) {
+		t.Errorf("expected b@example.com to be skipped, got %+v", b)
+	}
+}
+
+func TestPool_SendBatchTracing(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+
+	server := newFakeSMTPServer(t)
+	pool := mailer.NewPool(newTestAccount(t, "golangsp", server, 0))
+	collectResults(pool.SendBatch(context.Background(), newTestTemplate(t), newTestRecords("gopher@example.com"), mailer.BatchOptions{Subject: "Olá"}))
+
+	parents := make(map[string]string)
+	ids := make(map[string]string)
+	for _, span := range exporter.GetSpans() {
+		ids[span.SpanContext.SpanID().String()] = span.Name
+	}
+	for _, span := range exporter.GetSpans() {
+		parents[span.Name] = ids[span.Parent.SpanID().String()]
+	}
+
+	expected := map[string]string{
+		"recipient": "",
+		"render":    "recipient",
+		"send":      "recipient",
+		"connect":   "send",
+		"auth":      "send",
+		"envelope":  "send",
+		"data":      "send",
+		"quit":      "send",
+	}
+	for name, parent := range expected {
+		if got, ok := parents[name]; !ok || got != parent {
+			t.Errorf("expected span %q with parent %q, got %q (found: %v)", name, parent, got, ok)
+		}
+	}
+}
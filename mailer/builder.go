@@ -5,24 +5,50 @@ import (
 	"net/smtp"
 )
 
+// TLSMode defines how the connection to the SMTP server is secured.
+type TLSMode string
+
+const (
+	// TLSModeStartTLS upgrades a plain connection with the STARTTLS command,
+	// usually on port 587.
+	TLSModeStartTLS TLSMode = "starttls"
+	// TLSModeImplicit connects with TLS from the start, usually on port 465.
+	TLSModeImplicit TLSMode = "tls"
+	// TLSModeNone never uses TLS. Only meant for local test servers.
+	TLSModeNone TLSMode = "none"
+)
+
+// AuthMethod defines the SMTP authentication mechanism.
+type AuthMethod string
+
+const (
+	AuthPlain   AuthMethod = "plain"
+	AuthLogin   AuthMethod = "login"
+	AuthCRAMMD5 AuthMethod = "cram-md5"
+	AuthNone    AuthMethod = "none"
+)
+
 type MailerBuilder struct {
 	smtpHost      string
 	smtpPort      int
 	from          string
+	displayName   string
+	replyTo       string
 	password      string
-	auth          smtp.Auth
+	authMethod    AuthMethod
+	tlsMode       TLSMode
 	customHeaders map[string]string
 	attachments   []Attachment
 }
 
 func NewMailerBuilder(smtpHost string, SMTPPort int, from, password string) MailerBuilder {
-	auth := smtp.PlainAuth("", from, password, smtpHost)
 	return MailerBuilder{
 		smtpHost:      smtpHost,
 		smtpPort:      SMTPPort,
 		from:          from,
 		password:      password,
-		auth:          auth,
+		authMethod:    AuthPlain,
+		tlsMode:       TLSModeStartTLS,
 		customHeaders: make(map[string]string),
 		attachments:   make([]Attachment, 0),
 	}
@@ -32,8 +58,11 @@ func NewGMailMailerBuilder(from, password string) MailerBuilder {
 	return NewMailerBuilder("smtp.gmail.com", 587, from, password)
 }
 
+// NewOutlookMailerBuilder authenticates with LOGIN, like the outlook profile
+// preset, since Outlook does not always offer PLAIN.
 func NewOutlookMailerBuilder(from, password string) MailerBuilder {
-	return NewMailerBuilder("smtp-mail.outlook.com", 587, from, password)
+	return NewMailerBuilder("smtp-mail.outlook.com", 587, from, password).
+		WithAuthMethod(AuthLogin)
 }
 
 func (b MailerBuilder) WithHeader(key, value string) MailerBuilder {
@@ -62,12 +91,50 @@ func (b MailerBuilder) WithPort(port int) MailerBuilder {
 	return b
 }
 
+// WithDisplayName sets the name shown next to the sender address.
+func (b MailerBuilder) WithDisplayName(name string) MailerBuilder {
+	b.displayName = name
+	return b
+}
+
+func (b MailerBuilder) WithReplyTo(address string) MailerBuilder {
+	b.replyTo = address
+	return b
+}
+
+func (b MailerBuilder) WithTLSMode(mode TLSMode) MailerBuilder {
+	b.tlsMode = mode
+	return b
+}
+
+func (b MailerBuilder) WithAuthMethod(method AuthMethod) MailerBuilder {
+	b.authMethod = method
+	return b
+}
+
 func (b MailerBuilder) Build() Mailer {
 	return Mailer{
 		server:        fmt.Sprintf("%s:%d", b.smtpHost, b.smtpPort),
+		host:          b.smtpHost,
 		from:          b.from,
-		auth:          b.auth,
+		displayName:   b.displayName,
+		replyTo:       b.replyTo,
+		auth:          b.buildAuth(),
+		tlsMode:       b.tlsMode,
 		customHeaders: b.customHeaders,
 		attachments:   b.attachments,
 	}
 }
+
+func (b MailerBuilder) buildAuth() smtp.Auth {
+	switch b.authMethod {
+	case AuthNone:
+		return nil
+	case AuthLogin:
+		return LoginAuth(b.from, b.password, b.smtpHost)
+	case AuthCRAMMD5:
+		return smtp.CRAMMD5Auth(b.from, b.password)
+	default:
+		return smtp.PlainAuth("", b.from, b.password, b.smtpHost)
+	}
+}
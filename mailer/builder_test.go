@@ -13,26 +13,29 @@ func TestMailerBuilder(t *testing.T) {
 		"Gmail Builder": {
 			builder: NewGMailMailerBuilder("user@gmail.com", "password"),
 			expectedMailer: Mailer{
-				server: "smtp.gmail.com:587",
-				from:   "user@gmail.com",
-				auth:   smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				server:  "smtp.gmail.com:587",
+				from:    "user@gmail.com",
+				auth:    smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				tlsMode: TLSModeStartTLS,
 			},
 		},
 		"Outlook Builder": {
 			builder: NewOutlookMailerBuilder("user@outlook.com", "password"),
 			expectedMailer: Mailer{
-				server: "smtp-mail.outlook.com:587",
-				from:   "user@outlook.com",
-				auth:   smtp.PlainAuth("", "user@outlook.com", "password", "smtp-mail.outlook.com"),
+				server:  "smtp-mail.outlook.com:587",
+				from:    "user@outlook.com",
+				auth:    LoginAuth("user@outlook.com", "password", "smtp-mail.outlook.com"),
+				tlsMode: TLSModeStartTLS,
 			},
 		},
 		"Custom Headers": {
 			builder: NewGMailMailerBuilder("user@gmail.com", "password").
 				WithHeader("X-Custom-Header", "CustomValue"),
 			expectedMailer: Mailer{
-				server: "smtp.gmail.com:587",
-				from:   "user@gmail.com",
-				auth:   smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				server:  "smtp.gmail.com:587",
+				from:    "user@gmail.com",
+				auth:    smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				tlsMode: TLSModeStartTLS,
 				customHeaders: map[string]string{
 					"X-Custom-Header": "CustomValue",
 				},
@@ -42,9 +45,10 @@ func TestMailerBuilder(t *testing.T) {
 			builder: NewGMailMailerBuilder("user@gmail.com", "password").
 				WithAttachment("file.txt", "text/plain", "file123", true),
 			expectedMailer: Mailer{
-				server: "smtp.gmail.com:587",
-				from:   "user@gmail.com",
-				auth:   smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				server:  "smtp.gmail.com:587",
+				from:    "user@gmail.com",
+				auth:    smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				tlsMode: TLSModeStartTLS,
 				attachments: []Attachment{{
 					FileName:     "file.txt",
 					ContentType:  "text/plain",
@@ -58,17 +62,53 @@ func TestMailerBuilder(t *testing.T) {
 				WithHost("smtp.custom.com").
 				WithPort(2525),
 			expectedMailer: Mailer{
-				server: "smtp.custom.com:2525",
-				from:   "user@gmail.com",
-				auth:   smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				server:  "smtp.custom.com:2525",
+				from:    "user@gmail.com",
+				auth:    smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				tlsMode: TLSModeStartTLS,
 			},
 		},
 		"Custom Builder": {
 			builder: NewMailerBuilder("smtp.custom.com", 2525, "user@custom.com", "password"),
 			expectedMailer: Mailer{
-				server: "smtp.custom.com:2525",
-				from:   "user@custom.com",
-				auth:   smtp.PlainAuth("", "user@custom.com", "password", "smtp.custom.com"),
+				server:  "smtp.custom.com:2525",
+				from:    "user@custom.com",
+				auth:    smtp.PlainAuth("", "user@custom.com", "password", "smtp.custom.com"),
+				tlsMode: TLSModeStartTLS,
+			},
+		},
+		"Display Name and Reply-To": {
+			builder: NewGMailMailerBuilder("user@gmail.com", "password").
+				WithDisplayName("Golang SP").
+				WithReplyTo("contato@golang.sampa.br"),
+			expectedMailer: Mailer{
+				server:      "smtp.gmail.com:587",
+				from:        "user@gmail.com",
+				displayName: "Golang SP",
+				replyTo:     "contato@golang.sampa.br",
+				auth:        smtp.PlainAuth("", "user@gmail.com", "password", "smtp.gmail.com"),
+				tlsMode:     TLSModeStartTLS,
+			},
+		},
+		"Implicit TLS with Login Auth": {
+			builder: NewMailerBuilder("smtp.custom.com", 465, "user@custom.com", "password").
+				WithTLSMode(TLSModeImplicit).
+				WithAuthMethod(AuthLogin),
+			expectedMailer: Mailer{
+				server:  "smtp.custom.com:465",
+				from:    "user@custom.com",
+				auth:    LoginAuth("user@custom.com", "password", "smtp.custom.com"),
+				tlsMode: TLSModeImplicit,
+			},
+		},
+		"No Auth": {
+			builder: NewMailerBuilder("localhost", 1025, "user@localhost", "").
+				WithTLSMode(TLSModeNone).
+				WithAuthMethod(AuthNone),
+			expectedMailer: Mailer{
+				server:  "localhost:1025",
+				from:    "user@localhost",
+				tlsMode: TLSModeNone,
 			},
 		},
 	}
@@ -91,6 +131,12 @@ func compareMailers(a, b Mailer) bool {
 	if a.from != b.from {
 		return false
 	}
+	if a.displayName != b.displayName || a.replyTo != b.replyTo {
+		return false
+	}
+	if a.tlsMode != b.tlsMode {
+		return false
+	}
 	if !compareSMTPAuth(a.auth, b.auth) {
 		return false
 	}
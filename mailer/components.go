@@ -0,0 +1,74 @@
+package mailer
+
+import (
+	"embed"
+	"fmt"
+	"html/template"
+)
+
+// components are the built-in templates available to every template
+// directory. They render table based markup with inline styles, which email
+// clients such as Outlook display consistently:
+//
+//	{{template "button" (dict "Text" "Inscreva-se" "URL" "https://..." "Color" "#00ADD8")}}
+//	{{template "callout" (dict "Title" "Importante" "Text" "Traga seu notebook")}}
+//	{{template "key-value-table" (pairs "Horário" "19:00" "Local" "São Paulo")}}
+//
+// Color and Title are optional. A partial with the same name replaces the
+// built-in component.
+//
+//go:embed components/*.html
+var components embed.FS
+
+// KeyValue is a row of the key-value-table component.
+type KeyValue struct {
+	Key   string
+	Value any
+}
+
+// componentFuncs build the arguments of the components.
+var componentFuncs = template.FuncMap{
+	"dict":  dict,
+	"pairs": pairs,
+}
+
+// dict builds a map from alternating keys and values.
+func dict(keyValues ...any) (map[string]any, error) {
+	if len(keyValues)%2 != 0 {
+		return nil, fmt.Errorf("dict expects pairs of keys and values, got %d arguments", len(keyValues))
+	}
+
+	m := make(map[string]any, len(keyValues)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		key, ok := keyValues[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v is not a string", keyValues[i])
+		}
+		m[key] = keyValues[i+1]
+	}
+	return m, nil
+}
+
+// pairs builds the rows of a key-value-table from alternating keys and
+// values, keeping their order.
+func pairs(keyValues ...any) ([]KeyValue, error) {
+	if len(keyValues)%2 != 0 {
+		return nil, fmt.Errorf("pairs expects keys and values, got %d arguments", len(keyValues))
+	}
+
+	rows := make([]KeyValue, 0, len(keyValues)/2)
+	for i := 0; i < len(keyValues); i += 2 {
+		rows = append(rows, KeyValue{Key: fmt.Sprint(keyValues[i]), Value: keyValues[i+1]})
+	}
+	return rows, nil
+}
+
+// newTemplateSet parses the content into a set with the name, the functions
+// and the built-in components.
+func newTemplateSet(name string, content []byte, funcs template.FuncMap) (*template.Template, error) {
+	set, err := template.New(name).Funcs(funcs).ParseFS(components, "components/*.html")
+	if err != nil {
+		return nil, fmt.Errorf("could not parse the built-in components: %v", err)
+	}
+	return set.Parse(string(content))
+}
@@ -0,0 +1,192 @@
+package mailer
+
+import (
+	"fmt"
+	"html/template"
+	"slices"
+	"strings"
+	"text/template/parse"
+)
+
+// DataFields returns the fields of the data referenced by the template and
+// its subject, such as Nome for {{.Data.Nome}} or {{index .Data "Nome"}}, and
+// the required fields of its front matter, sorted and without duplicates.
+// Only the templates executed when rendering are read, so partials and blocks
+// that are never called do not count. References made through variables or
+// inside {{with .Data}} are not found.
+func (t EmailTemplate) DataFields() []string {
+	seen := make(map[string]bool)
+	for _, set := range []*template.Template{t.TmplHeader, t.TmplBody, t.TmplFooter} {
+		if set == nil {
+			continue
+		}
+		c := fieldCollector{seen: seen, visited: make(map[string]bool), lookup: func(name string) *parse.Tree {
+			if tmpl := set.Lookup(name); tmpl != nil {
+				return tmpl.Tree
+			}
+			return nil
+		}}
+		c.collectTemplate(set.Name())
+		if set == t.TmplBody {
+			c.collectTemplate(PreheaderTemplate)
+		}
+	}
+
+	if t.subject != nil {
+		c := fieldCollector{seen: seen, visited: make(map[string]bool), lookup: func(name string) *parse.Tree {
+			if tmpl := t.subject.Lookup(name); tmpl != nil {
+				return tmpl.Tree
+			}
+			return nil
+		}}
+		c.collectTemplate(t.subject.Name())
+	}
+	for _, field := range t.frontMatter.Required {
+		seen[field] = true
+	}
+
+	fields := make([]string, 0, len(seen))
+	for field := range seen {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
+// fieldCollector gathers the data fields of a template and of the templates
+// it calls, looked up by name in its set.
+type fieldCollector struct {
+	lookup  func(name string) *parse.Tree
+	seen    map[string]bool
+	visited map[string]bool
+}
+
+func (c fieldCollector) collectTemplate(name string) {
+	if c.visited[name] {
+		return
+	}
+	c.visited[name] = true
+	if tree := c.lookup(name); tree != nil {
+		c.collect(tree.Root)
+	}
+}
+
+func (c fieldCollector) collect(node parse.Node) {
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return
+		}
+		for _, child := range n.Nodes {
+			c.collect(child)
+		}
+	case *parse.ActionNode:
+		c.collect(n.Pipe)
+	case *parse.IfNode:
+		c.collectBranch(&n.BranchNode)
+	case *parse.RangeNode:
+		c.collectBranch(&n.BranchNode)
+	case *parse.WithNode:
+		c.collectBranch(&n.BranchNode)
+	case *parse.TemplateNode:
+		c.collect(n.Pipe)
+		c.collectTemplate(n.Name)
+	case *parse.PipeNode:
+		if n == nil {
+			return
+		}
+		for _, cmd := range n.Cmds {
+			c.collect(cmd)
+		}
+	case *parse.CommandNode:
+		if field, ok := indexedDataField(n); ok {
+			c.seen[field] = true
+		}
+		for _, arg := range n.Args {
+			c.collect(arg)
+		}
+	case *parse.FieldNode:
+		if len(n.Ident) >= 2 && n.Ident[0] == "Data" {
+			c.seen[n.Ident[1]] = true
+		}
+	case *parse.VariableNode:
+		if len(n.Ident) >= 3 && n.Ident[0] == "$" && n.Ident[1] == "Data" {
+			c.seen[n.Ident[2]] = true
+		}
+	}
+}
+
+func (c fieldCollector) collectBranch(n *parse.BranchNode) {
+	c.collect(n.Pipe)
+	c.collect(n.List)
+	c.collect(n.ElseList)
+}
+
+// indexedDataField returns the field of an {{index .Data "Field"}} command.
+func indexedDataField(cmd *parse.CommandNode) (string, bool) {
+	if len(cmd.Args) != 3 {
+		return "", false
+	}
+	if ident, ok := cmd.Args[0].(*parse.IdentifierNode); !ok || ident.Ident != "index" {
+		return "", false
+	}
+	if data, ok := cmd.Args[1].(*parse.FieldNode); !ok || len(data.Ident) != 1 || data.Ident[0] != "Data" {
+		return "", false
+	}
+	key, ok := cmd.Args[2].(*parse.StringNode)
+	if !ok {
+		return "", false
+	}
+	return key.Text, true
+}
+
+// MissingFieldsError lists the fields referenced by a template that are not
+// in the data, such as the columns of a CSV file.
+type MissingFieldsError struct {
+	Missing []string
+	// Suggestions maps a missing field to the data field that only differs
+	// from it in case, such as Nome and nome.
+	Suggestions map[string]string
+}
+
+func (e *MissingFieldsError) Error() string {
+	descriptions := make([]string, 0, len(e.Missing))
+	for _, field := range e.Missing {
+		if suggestion, ok := e.Suggestions[field]; ok {
+			field = fmt.Sprintf("%s (did you mean %s?)", field, suggestion)
+		}
+		descriptions = append(descriptions, field)
+	}
+	return "template uses fields missing from the data: " + strings.Join(descriptions, ", ")
+}
+
+// CheckFields returns a *MissingFieldsError when the template references
+// fields of the data that are not in fields, so a campaign can be stopped
+// before rendering any email with empty values.
+func (t EmailTemplate) CheckFields(fields []string) error {
+	available := make(map[string]bool, len(fields))
+	byLower := make(map[string]string, len(fields))
+	for _, field := range fields {
+		available[field] = true
+		byLower[strings.ToLower(field)] = field
+	}
+
+	var missingErr MissingFieldsError
+	for _, field := range t.DataFields() {
+		if available[field] {
+			continue
+		}
+		missingErr.Missing = append(missingErr.Missing, field)
+		if suggestion, ok := byLower[strings.ToLower(field)]; ok {
+			if missingErr.Suggestions == nil {
+				missingErr.Suggestions = make(map[string]string)
+			}
+			missingErr.Suggestions[field] = suggestion
+		}
+	}
+
+	if len(missingErr.Missing) > 0 {
+		return &missingErr
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package mailer_test
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+func TestEmailTemplate_CheckFields(t *testing.T) {
+	tests := map[string]struct {
+		header      string
+		body        string
+		fields      []string
+		expected    []string
+		missing     []string
+		suggestions map[string]string
+	}{
+		"Every Field Present": {
+			body:     `<p>Olá {{.Data.Nome}}, seu cupom é {{.Data.Cupom}}.</p>`,
+			fields:   []string{"Email", "Nome", "Cupom"},
+			expected: []string{"Cupom", "Nome"},
+		},
+		"Field Missing": {
+			body:     `<p>Olá {{.Data.Nome}}, seu cupom é {{.Data.Cupom}}.</p>`,
+			fields:   []string{"Email", "Nome"},
+			expected: []string{"Cupom", "Nome"},
+			missing:  []string{"Cupom"},
+		},
+		"Field With Another Case": {
+			body:        `<p>Olá {{ .Data.Nome }}.</p>`,
+			fields:      []string{"Email", "nome"},
+			expected:    []string{"Nome"},
+			missing:     []string{"Nome"},
+			suggestions: map[string]string{"Nome": "nome"},
+		},
+		"Fields In Branches, Functions And Index": {
+			header: `{{if .Data.Vip}}VIP{{else}}{{.Data.Tipo}}{{end}}`,
+			body: `{{range $i, $c := split .Data.Cursos}}{{$.Data.Nome}}{{end}}` +
+				`{{with index .Data "Cidade"}}{{.}}{{end}}{{template "partial" .}}{{define "partial"}}{{title .Data.Apelido}}{{end}}`,
+			fields:   []string{"Apelido", "Cidade", "Cursos", "Nome", "Tipo", "Vip"},
+			expected: []string{"Apelido", "Cidade", "Cursos", "Nome", "Tipo", "Vip"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "header.html", tt.header)
+			createTempFile(t, tmpDir, "footer.html", "")
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+
+			emailTemplate, err := mailer.NewEmailTemplateBuilder(tmpDir, "body1.html", "").
+				WithFuncs(map[string]any{"split": func(s string) []string { return nil }}).
+				Build()
+			if err != nil {
+				t.Fatalf("Failed to create EmailTemplate: %v", err)
+			}
+
+			if fields := emailTemplate.DataFields(); !reflect.DeepEqual(fields, tt.expected) {
+				t.Errorf("DataFields() = %v, expected %v", fields, tt.expected)
+			}
+
+			err = emailTemplate.CheckFields(tt.fields)
+			if tt.missing == nil {
+				if err != nil {
+					t.Errorf("CheckFields() error = %v, expected none", err)
+				}
+				return
+			}
+
+			var missingErr *mailer.MissingFieldsError
+			if !errors.As(err, &missingErr) {
+				t.Fatalf("CheckFields() error = %v, expected a MissingFieldsError", err)
+			}
+			if !reflect.DeepEqual(missingErr.Missing, tt.missing) {
+				t.Errorf("Missing = %v, expected %v", missingErr.Missing, tt.missing)
+			}
+			if !reflect.DeepEqual(missingErr.Suggestions, tt.suggestions) {
+				t.Errorf("Suggestions = %v, expected %v", missingErr.Suggestions, tt.suggestions)
+			}
+		})
+	}
+}
+
+func TestEmailTemplate_DataFieldsReachable(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTempFile(t, tmpDir, "layout.html", `<h1>{{.Data.Titulo}}</h1>{{block "content" .}}{{end}}{{block "footer" .}}{{.Data.Rodape}}{{end}}`)
+	createTempFile(t, filepath.Join(tmpDir, "partials"), "used.html", `{{.Data.Cidade}}`)
+	createTempFile(t, filepath.Join(tmpDir, "partials"), "unused.html", `{{.Data.Cupom}}`)
+	createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html",
+		`{{define "content"}}<p>Olá {{.Data.Nome}}, {{template "used" .}}</p>{{end}}{{define "footer"}}Golang SP{{end}}`)
+
+	emailTemplate, err := mailer.NewEmailTemplate(tmpDir, "body1.html", "")
+	if err != nil {
+		t.Fatalf("Failed to create EmailTemplate: %v", err)
+	}
+
+	// The unused partial and the footer replaced by the body are not rendered,
+	// so their fields are not required.
+	expected := []string{"Cidade", "Nome", "Titulo"}
+	if fields := emailTemplate.DataFields(); !reflect.DeepEqual(fields, expected) {
+		t.Errorf("DataFields() = %v, expected %v", fields, expected)
+	}
+}
+
+func TestEmailTemplate_ExecuteStrict(t *testing.T) {
+	body := "<p>Olá {{.Data.Nome}}.</p>"
+
+	tests := map[string]struct {
+		body        string
+		strict      bool
+		data        map[string]string
+		expected    string
+		expectError bool
+	}{
+		"Field Present": {
+			body:     body,
+			strict:   true,
+			data:     map[string]string{"Nome": "Ana"},
+			expected: "<p>Olá Ana.</p>",
+		},
+		"Field Missing": {
+			body:        body,
+			strict:      true,
+			data:        map[string]string{"nome": "Ana"},
+			expectError: true,
+		},
+		"Field Missing Without Strict": {
+			body:     body,
+			strict:   false,
+			data:     map[string]string{"nome": "Ana"},
+			expected: "<p>Olá .</p>",
+		},
+		"Optional Component Arguments": {
+			body:     body + `{{template "button" (dict "Text" "Go" "URL" "https://go.dev")}}`,
+			strict:   true,
+			data:     map[string]string{"Nome": "Ana"},
+			expected: "<p>Olá Ana.</p>",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "header.html", "")
+			createTempFile(t, tmpDir, "footer.html", "")
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+
+			emailTemplate, err := mailer.NewEmailTemplateBuilder(tmpDir, "body1.html", "").WithStrict(tt.strict).Build()
+			if err != nil {
+				t.Fatalf("Failed to create EmailTemplate: %v", err)
+			}
+
+			result, err := emailTemplate.Execute(tt.data)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Execute() error = %v, expectError %v", err, tt.expectError)
+			}
+			if !tt.expectError && !strings.HasPrefix(result, tt.expected) {
+				t.Errorf("Execute() result = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
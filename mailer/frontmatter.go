@@ -0,0 +1,85 @@
+package mailer
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+
+	"gopkg.in/yaml.v3"
+)
+
+// FrontMatter holds the options of a body file, written as YAML between two
+// --- lines at its start:
+//
+//	---
+//	subject: "📅 Lembrete: {{.Data.Nome}}, o workshop é amanhã!"
+//	preheader: Traga seu notebook
+//	from: Golang SP <golangsp@gmail.com>
+//	attachments:
+//	  - file: assets/images/golang-sp-simbolo.png
+//	    content_type: image/png
+//	    content_id: logo
+//	    base64: true
+//	required: [Nome]
+//	---
+//	<p>Olá, {{.Data.Nome}}!</p>
+type FrontMatter struct {
+	// Subject is rendered for each recipient with text/template and the same
+	// data and functions as the body.
+	Subject string `yaml:"subject"`
+	// Preheader is the summary shown by the email clients after the subject.
+	// It is a template like the subject, used when the body does not define
+	// a "preheader" template.
+	Preheader string `yaml:"preheader"`
+	// From replaces the From header of the sender, e.g. to change its display
+	// name.
+	From        string       `yaml:"from"`
+	Attachments []Attachment `yaml:"attachments"`
+	// Required are the fields of the data that must not be empty.
+	Required []string `yaml:"required"`
+}
+
+var frontMatterDelimiter = []byte("---")
+
+// parseFrontMatter splits the front matter from the content of a body file.
+// Content without front matter is returned as is.
+func parseFrontMatter(content []byte) (FrontMatter, []byte, error) {
+	first, rest, found := bytes.Cut(content, []byte("\n"))
+	if !found || !bytes.Equal(bytes.TrimSpace(first), frontMatterDelimiter) {
+		return FrontMatter{}, content, nil
+	}
+
+	var yamlContent []byte
+	for {
+		var line []byte
+		line, rest, found = bytes.Cut(rest, []byte("\n"))
+		if bytes.Equal(bytes.TrimSpace(line), frontMatterDelimiter) {
+			break
+		}
+		if !found {
+			return FrontMatter{}, nil, errors.New("front matter is not closed with a --- line")
+		}
+		yamlContent = append(append(yamlContent, line...), '\n')
+	}
+
+	var frontMatter FrontMatter
+	decoder := yaml.NewDecoder(bytes.NewReader(yamlContent))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&frontMatter); err != nil && !errors.Is(err, io.EOF) {
+		return FrontMatter{}, nil, fmt.Errorf("invalid front matter: %v", err)
+	}
+
+	if frontMatter.From != "" {
+		if _, err := mail.ParseAddress(frontMatter.From); err != nil {
+			return FrontMatter{}, nil, fmt.Errorf("invalid front matter: from: %v", err)
+		}
+	}
+	for _, attachment := range frontMatter.Attachments {
+		if attachment.FileName == "" {
+			return FrontMatter{}, nil, errors.New("invalid front matter: attachment file is required")
+		}
+	}
+	return frontMatter, rest, nil
+}
@@ -0,0 +1,106 @@
+package mailer_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+func TestEmailTemplate_RenderFrontMatter(t *testing.T) {
+	tests := map[string]struct {
+		body        string
+		subject     string
+		data        map[string]string
+		expected    mailer.Email
+		buildError  bool
+		renderError bool
+	}{
+		"Without Front Matter": {
+			body:     "<p>Olá, {{.Data.Nome}}!</p>",
+			data:     map[string]string{"Nome": "Ana"},
+			expected: mailer.Email{Body: "<p>Olá, Ana!</p>"},
+		},
+		"Subject Template": {
+			body:     "---\nsubject: \"{{.Data.Nome}}, você foi aprovado!\"\n---\n<p>Olá, {{.Data.Nome}}!</p>",
+			data:     map[string]string{"Nome": "Ana"},
+			expected: mailer.Email{Subject: "Ana, você foi aprovado!", Body: "<p>Olá, Ana!</p>"},
+		},
+		"Subject With Functions And Line Breaks": {
+			body:     "---\nsubject: \"Olá, {{title .Data.Nome}}\"\n---\n",
+			data:     map[string]string{"Nome": "ana\r\nBcc: spam@example.com"},
+			expected: mailer.Email{Subject: "Olá, Ana Bcc: Spam@example.com"},
+		},
+		"Subject Of The Builder": {
+			body:     "---\nsubject: Do arquivo\n---\n",
+			subject:  "Do builder, {{.Data.Nome}}",
+			data:     map[string]string{"Nome": "Ana"},
+			expected: mailer.Email{Subject: "Do builder, Ana"},
+		},
+		"From And Attachments": {
+			body: "---\nfrom: Golang SP <contato@golang.sampa.br>\nattachments:\n" +
+				"  - file: logo.png\n    content_type: image/png\n    content_id: logo\n    base64: true\n---\n<img src=\"cid:logo\">",
+			expected: mailer.Email{
+				Body:        `<img src="cid:logo">`,
+				From:        "Golang SP <contato@golang.sampa.br>",
+				Attachments: []mailer.Attachment{{FileName: "logo.png", ContentType: "image/png", ContentID: "logo", Base64Encode: true}},
+			},
+		},
+		"Required Field Present": {
+			body:     "---\nrequired: [Cupom]\n---\n{{.Data.Cupom}}",
+			data:     map[string]string{"Cupom": "GO-2024"},
+			expected: mailer.Email{Body: "GO-2024"},
+		},
+		"Required Field Empty": {
+			body:        "---\nrequired: [Cupom]\n---\n{{.Data.Cupom}}",
+			data:        map[string]string{"Cupom": " "},
+			renderError: true,
+		},
+		"Unknown Field": {
+			body:       "---\nsubjet: Olá\n---\n",
+			buildError: true,
+		},
+		"Invalid From": {
+			body:       "---\nfrom: golang sp\n---\n",
+			buildError: true,
+		},
+		"Unclosed Front Matter": {
+			body:       "---\nsubject: Olá\n<p>Olá</p>",
+			buildError: true,
+		},
+		"Invalid Subject Template": {
+			body:       "---\nsubject: \"{{.Data.Nome\"\n---\n",
+			buildError: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "header.html", "")
+			createTempFile(t, tmpDir, "footer.html", "")
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+
+			emailTemplate, err := mailer.NewEmailTemplateBuilder(tmpDir, "body1.html", "").WithSubject(tt.subject).Build()
+			if (err != nil) != tt.buildError {
+				t.Fatalf("Build() error = %v, expectError %v", err, tt.buildError)
+			}
+			if tt.buildError {
+				return
+			}
+
+			email, err := emailTemplate.Render(context.Background(), tt.data)
+			if (err != nil) != tt.renderError {
+				t.Fatalf("Render() error = %v, expectError %v", err, tt.renderError)
+			}
+			if tt.renderError {
+				return
+			}
+			if !reflect.DeepEqual(email, tt.expected) {
+				t.Errorf("Render() = %+v, expected %+v", email, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,273 @@
+package mailer
+
+import (
+	"encoding/base64"
+	"fmt"
+	"html/template"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"rsc.io/qr"
+)
+
+// DefaultLocale is the locale of the date function unless the template is
+// built with another one.
+const DefaultLocale = "pt-BR"
+
+// locale holds the month and weekday names of a language, indexed like
+// time.Month and time.Weekday.
+type locale struct {
+	months        [12]string
+	weekdays      [7]string
+	shortMonths   [12]string
+	shortWeekdays [7]string
+}
+
+var locales = map[string]locale{
+	"en": {
+		months:        [12]string{"January", "February", "March", "April", "May", "June", "July", "August", "September", "October", "November", "December"},
+		weekdays:      [7]string{"Sunday", "Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday"},
+		shortMonths:   [12]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"},
+		shortWeekdays: [7]string{"Sun", "Mon", "Tue", "Wed", "Thu", "Fri", "Sat"},
+	},
+	"pt-BR": {
+		months:        [12]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho", "agosto", "setembro", "outubro", "novembro", "dezembro"},
+		weekdays:      [7]string{"domingo", "segunda-feira", "terça-feira", "quarta-feira", "quinta-feira", "sexta-feira", "sábado"},
+		shortMonths:   [12]string{"jan", "fev", "mar", "abr", "mai", "jun", "jul", "ago", "set", "out", "nov", "dez"},
+		shortWeekdays: [7]string{"dom", "seg", "ter", "qua", "qui", "sex", "sáb"},
+	},
+	"es": {
+		months:        [12]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio", "agosto", "septiembre", "octubre", "noviembre", "diciembre"},
+		weekdays:      [7]string{"domingo", "lunes", "martes", "miércoles", "jueves", "viernes", "sábado"},
+		shortMonths:   [12]string{"ene", "feb", "mar", "abr", "may", "jun", "jul", "ago", "sep", "oct", "nov", "dic"},
+		shortWeekdays: [7]string{"dom", "lun", "mar", "mié", "jue", "vie", "sáb"},
+	},
+}
+
+func init() {
+	locales["pt"] = locales["pt-BR"]
+}
+
+// templateFuncs returns the functions available to the templates, with the
+// date function in the given locale. The custom functions are added last, so
+// they can replace the built-in ones.
+func templateFuncs(localeName string, custom template.FuncMap) template.FuncMap {
+	funcs := template.FuncMap{
+		"date": func(layout string, value any) (string, error) {
+			return formatDate(localeName, layout, value)
+		},
+		"dateIn":    formatDate,
+		"parseDate": parseDate,
+		"title":     title,
+		"default":   defaultValue,
+		"plural":    plural,
+		"brl":       brl,
+		"qrcode":    qrcode,
+	}
+	for name, fn := range componentFuncs {
+		funcs[name] = fn
+	}
+	for name, fn := range custom {
+		funcs[name] = fn
+	}
+	return funcs
+}
+
+// dateLayouts are the formats parseDate accepts, tried in order.
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"02/01/2006 15:04:05",
+	"02/01/2006 15:04",
+	"02/01/2006",
+}
+
+// parseDate parses dates in the ISO 8601 format, such as 2024-08-06 or
+// 2024-08-06 19:00, or in the Brazilian one, such as 06/08/2024 19:00.
+func parseDate(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("could not parse date %q, expected a format such as 2006-01-02 or 02/01/2006", value)
+}
+
+// formatDate formats a date, or a string parsed with parseDate, with a Go
+// time layout whose month and weekday names are written in the locale.
+func formatDate(localeName, layout string, value any) (string, error) {
+	names, ok := locales[localeName]
+	if !ok {
+		return "", fmt.Errorf("unknown locale %q", localeName)
+	}
+
+	var t time.Time
+	switch v := value.(type) {
+	case time.Time:
+		t = v
+	case string:
+		parsed, err := parseDate(v)
+		if err != nil {
+			return "", err
+		}
+		t = parsed
+	default:
+		return "", fmt.Errorf("could not format %v as a date", value)
+	}
+
+	// The names are written apart from the rest of the layout, since
+	// time.Format only writes them in English.
+	var b strings.Builder
+	start := 0
+	for i := 0; i < len(layout); i++ {
+		name, size := localizedName(names, t, layout[i:])
+		if size == 0 {
+			continue
+		}
+		b.WriteString(t.Format(layout[start:i]))
+		b.WriteString(name)
+		i += size - 1
+		start = i + 1
+	}
+	b.WriteString(t.Format(layout[start:]))
+	return b.String(), nil
+}
+
+// localizedName returns the name of the month or weekday layout element at
+// the start of the layout and its length, or a zero length when the layout
+// does not start with one. It follows the rules of time.Format, where Jan and
+// Mon are not elements when followed by a lowercase letter.
+func localizedName(names locale, t time.Time, layout string) (string, int) {
+	switch {
+	case strings.HasPrefix(layout, "January"):
+		return names.months[t.Month()-1], len("January")
+	case strings.HasPrefix(layout, "Jan") && !startsWithLower(layout[3:]):
+		return names.shortMonths[t.Month()-1], len("Jan")
+	case strings.HasPrefix(layout, "Monday"):
+		return names.weekdays[t.Weekday()], len("Monday")
+	case strings.HasPrefix(layout, "Mon") && !startsWithLower(layout[3:]):
+		return names.shortWeekdays[t.Weekday()], len("Mon")
+	}
+	return "", 0
+}
+
+func startsWithLower(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsLower(r)
+}
+
+// lowercaseWords stay in lowercase in the middle of a title, as in
+// "Renê Cardozo da Silva".
+var lowercaseWords = map[string]bool{
+	"a": true, "o": true, "e": true, "de": true, "da": true, "do": true, "das": true, "dos": true,
+	"di": true, "du": true, "em": true, "na": true, "no": true, "y": true, "von": true, "van": true,
+}
+
+// title capitalizes the first letter of each word and lowercases the others,
+// keeping connectives such as "de" and "da" in lowercase.
+func title(s string) string {
+	words := strings.Fields(strings.ToLower(s))
+	for i, word := range words {
+		if i > 0 && lowercaseWords[word] {
+			continue
+		}
+		runes := []rune(word)
+		runes[0] = unicode.ToUpper(runes[0])
+		words[i] = string(runes)
+	}
+	return strings.Join(words, " ")
+}
+
+// defaultValue returns the value, or the fallback when the value is empty or
+// blank. The value comes last so it can be piped, as in
+// {{.Data.Nome | default "participante"}}.
+func defaultValue(fallback string, value any) any {
+	switch v := value.(type) {
+	case nil:
+		return fallback
+	case string:
+		if strings.TrimSpace(v) == "" {
+			return fallback
+		}
+	}
+	return value
+}
+
+// plural returns the singular form when the count is 1 or -1, and the plural
+// form otherwise, as in {{.Data.Vagas}} {{plural .Data.Vagas "vaga" "vagas"}}.
+func plural(count any, singular, pluralForm string) (string, error) {
+	n, err := toFloat(count)
+	if err != nil {
+		return "", err
+	}
+	if math.Abs(n) == 1 {
+		return singular, nil
+	}
+	return pluralForm, nil
+}
+
+// brl formats a value in Brazilian reais, as in R$ 1.234,56. Strings may use
+// a dot or, when there is a comma, the Brazilian separators.
+func brl(value any) (string, error) {
+	amount, err := toFloat(value)
+	if err != nil {
+		return "", err
+	}
+
+	cents := int64(math.Round(math.Abs(amount) * 100))
+	digits := strconv.FormatInt(cents/100, 10)
+	var integer strings.Builder
+	for i, digit := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			integer.WriteByte('.')
+		}
+		integer.WriteRune(digit)
+	}
+
+	formatted := fmt.Sprintf("R$ %s,%02d", integer.String(), cents%100)
+	if amount < 0 && cents > 0 {
+		formatted = "-" + formatted
+	}
+	return formatted, nil
+}
+
+func toFloat(value any) (float64, error) {
+	switch v := value.(type) {
+	case int:
+		return float64(v), nil
+	case int64:
+		return float64(v), nil
+	case float64:
+		return v, nil
+	case string:
+		s := strings.TrimSpace(v)
+		if strings.Contains(s, ",") {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		}
+		n, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%q is not a number", v)
+		}
+		return n, nil
+	}
+	return 0, fmt.Errorf("%v is not a number", value)
+}
+
+// qrcode returns a PNG data URI of a QR code with the text, to be used as the
+// src of an image. Some clients, such as Gmail, do not show data URIs, so
+// attaching the image and referencing its Content-ID is more portable.
+func qrcode(text string) (template.URL, error) {
+	code, err := qr.Encode(text, qr.M)
+	if err != nil {
+		return "", fmt.Errorf("could not encode QR code: %v", err)
+	}
+	return template.URL("data:image/png;base64," + base64.StdEncoding.EncodeToString(code.PNG())), nil
+}
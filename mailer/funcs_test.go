@@ -0,0 +1,142 @@
+package mailer_test
+
+import (
+	"html/template"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+func TestEmailTemplate_Funcs(t *testing.T) {
+	tests := map[string]struct {
+		body        string
+		data        map[string]string
+		locale      string
+		funcs       template.FuncMap
+		expected    string
+		expectError bool
+	}{
+		"Date In The Default Locale": {
+			body:     `{{date "Monday, 02 de January de 2006" .Data.Data}}`,
+			data:     map[string]string{"Data": "2024-08-06"},
+			expected: "terça-feira, 06 de agosto de 2024",
+		},
+		"Date With Short Names": {
+			body:     `{{date "Mon 02/Jan 15:04" .Data.Data}}`,
+			data:     map[string]string{"Data": "06/08/2024 19:00"},
+			expected: "ter 06/ago 19:00",
+		},
+		"Date In Another Locale": {
+			body:     `{{dateIn "en" "January 2, 2006" .Data.Data}}`,
+			data:     map[string]string{"Data": "2024-08-06"},
+			expected: "August 6, 2024",
+		},
+		"Date With The Locale Of The Builder": {
+			body:     `{{date "2 de January" .Data.Data}}`,
+			data:     map[string]string{"Data": "2024-08-06"},
+			locale:   "es",
+			expected: "6 de agosto",
+		},
+		"Invalid Date": {
+			body:        `{{date "02/01/2006" .Data.Data}}`,
+			data:        map[string]string{"Data": "amanhã"},
+			expectError: true,
+		},
+		"Title": {
+			body:     `{{title .Data.Nome}}`,
+			data:     map[string]string{"Nome": "RENÊ cardozo DA silva"},
+			expected: "Renê Cardozo da Silva",
+		},
+		"Default With Value": {
+			body:     `{{.Data.Nome | default "participante"}}`,
+			data:     map[string]string{"Nome": "Ana"},
+			expected: "Ana",
+		},
+		"Default Without Value": {
+			body:     `{{.Data.Nome | default "participante"}}`,
+			data:     map[string]string{"Nome": " "},
+			expected: "participante",
+		},
+		"Singular": {
+			body:     `{{.Data.Vagas}} {{plural .Data.Vagas "vaga" "vagas"}}`,
+			data:     map[string]string{"Vagas": "1"},
+			expected: "1 vaga",
+		},
+		"Plural": {
+			body:     `{{.Data.Vagas}} {{plural .Data.Vagas "vaga" "vagas"}}`,
+			data:     map[string]string{"Vagas": "0"},
+			expected: "0 vagas",
+		},
+		"BRL": {
+			body:     `{{brl .Data.Valor}}`,
+			data:     map[string]string{"Valor": "1234567.891"},
+			expected: "R$ 1.234.567,89",
+		},
+		"BRL With Brazilian Separators": {
+			body:     `{{brl .Data.Valor}}`,
+			data:     map[string]string{"Valor": "-1.234,5"},
+			expected: "-R$ 1.234,50",
+		},
+		"Invalid BRL": {
+			body:        `{{brl .Data.Valor}}`,
+			data:        map[string]string{"Valor": "grátis"},
+			expectError: true,
+		},
+		"QR Code": {
+			body:     `<img src="{{qrcode .Data.Link}}">`,
+			data:     map[string]string{"Link": "https://golang.sampa.br"},
+			expected: `<img src="data:image/png;base64,iVBORw0KGgo`,
+		},
+		"Custom Function": {
+			body:     `{{shout .Data.Nome}}`,
+			data:     map[string]string{"Nome": "Ana"},
+			funcs:    template.FuncMap{"shout": func(s string) string { return strings.ToUpper(s) + "!" }},
+			expected: "ANA!",
+		},
+		"Custom Function Replacing A Built-in": {
+			body:     `{{title .Data.Nome}}`,
+			data:     map[string]string{"Nome": "ana"},
+			funcs:    template.FuncMap{"title": func(s string) string { return "Sra. " + s }},
+			expected: "Sra. ana",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "header.html", "")
+			createTempFile(t, tmpDir, "footer.html", "")
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+
+			builder := mailer.NewEmailTemplateBuilder(tmpDir, "body1.html", "http://golang.samba.br").WithFuncs(tt.funcs)
+			if tt.locale != "" {
+				builder = builder.WithLocale(tt.locale)
+			}
+			emailTemplate, err := builder.Build()
+			if err != nil {
+				t.Fatalf("Failed to create EmailTemplate: %v", err)
+			}
+
+			result, err := emailTemplate.Execute(tt.data)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Execute() error = %v, expectError %v", err, tt.expectError)
+			}
+			if !strings.HasPrefix(result, tt.expected) {
+				t.Errorf("Execute() result = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmailTemplateBuilder_UnknownLocale(t *testing.T) {
+	tmpDir := t.TempDir()
+	createTempFile(t, tmpDir, "layout.html", `{{block "content" .}}{{end}}`)
+	createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", "")
+
+	_, err := mailer.NewEmailTemplateBuilder(tmpDir, "body1.html", "").WithLocale("klingon").Build()
+	if err == nil {
+		t.Errorf("Expected error but got none")
+	}
+}
@@ -0,0 +1,387 @@
+package mailer
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// cssRule is a rule of a style sheet with a single selector, such as
+// ".email-body p { margin: 10px 0 }".
+type cssRule struct {
+	selector    []compoundSelector
+	specificity [3]int
+	// order is the position of the rule in the document, which breaks ties
+	// between rules with the same specificity.
+	order        int
+	declarations []cssDeclaration
+}
+
+// compoundSelector is a part of a selector matched against a single element,
+// such as p or a.button#cta.
+type compoundSelector struct {
+	element string
+	id      string
+	classes []string
+}
+
+type cssDeclaration struct {
+	property  string
+	value     string
+	important bool
+}
+
+// inlineCSS moves the rules of the <style> blocks of a document into the
+// style attributes of the elements they select, since clients such as Gmail
+// and Outlook drop the blocks. Rules with class, id, element and descendant
+// selectors are inlined in the order of their specificity, and the style
+// attributes written in the template take precedence over them, unless the
+// rules are !important. Media queries, other at-rules and rules with other
+// selectors, such as a:hover, stay in the <style> blocks.
+func inlineCSS(document string) (string, error) {
+	root, err := html.Parse(strings.NewReader(document))
+	if err != nil {
+		return "", fmt.Errorf("could not parse HTML to inline CSS: %v", err)
+	}
+
+	var rules []cssRule
+	var styles []*html.Node
+	walkElements(root, func(n *html.Node) bool {
+		if n.DataAtom == atom.Style {
+			styles = append(styles, n)
+		}
+		return true
+	})
+	for _, style := range styles {
+		var text strings.Builder
+		for c := style.FirstChild; c != nil; c = c.NextSibling {
+			text.WriteString(c.Data)
+		}
+
+		inlined, kept := parseStyleSheet(text.String(), len(rules))
+		rules = append(rules, inlined...)
+
+		for style.FirstChild != nil {
+			style.RemoveChild(style.FirstChild)
+		}
+		if kept == "" {
+			style.Parent.RemoveChild(style)
+			continue
+		}
+		style.AppendChild(&html.Node{Type: html.TextNode, Data: kept})
+	}
+
+	if len(rules) > 0 {
+		walkElements(root, func(n *html.Node) bool {
+			if n.DataAtom == atom.Head {
+				return false
+			}
+			applyRules(n, rules)
+			return true
+		})
+	}
+
+	var b strings.Builder
+	if err := html.Render(&b, root); err != nil {
+		return "", fmt.Errorf("could not render HTML with inlined CSS: %v", err)
+	}
+	return b.String(), nil
+}
+
+// walkElements calls visit for the elements of the tree in document order,
+// skipping the children of the ones for which visit returns false.
+func walkElements(n *html.Node, visit func(*html.Node) bool) {
+	for c := n.FirstChild; c != nil; {
+		// The visit may remove the element from the tree.
+		next := c.NextSibling
+		if c.Type != html.ElementNode || visit(c) {
+			walkElements(c, visit)
+		}
+		c = next
+	}
+}
+
+// applyRules sets the style attribute of the element to the declarations of
+// the rules that match it, followed by its own declarations.
+func applyRules(n *html.Node, rules []cssRule) {
+	var matched []cssRule
+	for _, rule := range rules {
+		if rule.matches(n) {
+			matched = append(matched, rule)
+		}
+	}
+	if len(matched) == 0 {
+		return
+	}
+	slices.SortStableFunc(matched, func(a, b cssRule) int {
+		if c := slices.Compare(a.specificity[:], b.specificity[:]); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.order, b.order)
+	})
+
+	styleIndex := -1
+	var own []cssDeclaration
+	for i, attr := range n.Attr {
+		if attr.Key == "style" {
+			styleIndex = i
+			own = parseDeclarations(attr.Val)
+		}
+	}
+
+	// The declarations are applied from the lowest to the highest precedence:
+	// the rules, the style attribute and then the !important ones.
+	var properties []string
+	values := make(map[string]string)
+	apply := func(declarations []cssDeclaration, important bool) {
+		for _, d := range declarations {
+			if d.important != important {
+				continue
+			}
+			if _, ok := values[d.property]; !ok {
+				properties = append(properties, d.property)
+			}
+			values[d.property] = d.value
+			if d.important {
+				values[d.property] += " !important"
+			}
+		}
+	}
+	for _, rule := range matched {
+		apply(rule.declarations, false)
+	}
+	apply(own, false)
+	for _, rule := range matched {
+		apply(rule.declarations, true)
+	}
+	apply(own, true)
+
+	declarations := make([]string, 0, len(properties))
+	for _, property := range properties {
+		declarations = append(declarations, property+": "+values[property])
+	}
+	style := strings.Join(declarations, "; ") + ";"
+
+	if styleIndex >= 0 {
+		n.Attr[styleIndex].Val = style
+		return
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: "style", Val: style})
+}
+
+// matches reports whether the rule selects the element. The last compound
+// selector must match the element and each of the others one of its
+// ancestors, in order.
+func (r cssRule) matches(n *html.Node) bool {
+	last := len(r.selector) - 1
+	if !r.selector[last].matches(n) {
+		return false
+	}
+	i := last - 1
+	for ancestor := n.Parent; ancestor != nil && i >= 0; ancestor = ancestor.Parent {
+		if ancestor.Type == html.ElementNode && r.selector[i].matches(ancestor) {
+			i--
+		}
+	}
+	return i < 0
+}
+
+func (s compoundSelector) matches(n *html.Node) bool {
+	if s.element != "" && s.element != n.Data {
+		return false
+	}
+	var id, class string
+	for _, attr := range n.Attr {
+		switch attr.Key {
+		case "id":
+			id = attr.Val
+		case "class":
+			class = attr.Val
+		}
+	}
+	if s.id != "" && s.id != id {
+		return false
+	}
+	classes := strings.Fields(class)
+	for _, c := range s.classes {
+		if !slices.Contains(classes, c) {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	cssComment              = regexp.MustCompile(`(?s)/\*.*?\*/`)
+	compoundSelectorPattern = regexp.MustCompile(`^([a-zA-Z][a-zA-Z0-9-]*)?((?:[.#][a-zA-Z0-9_-]+)*)$`)
+	simpleSelector          = regexp.MustCompile(`[.#][a-zA-Z0-9_-]+`)
+)
+
+// parseStyleSheet returns the rules of the style sheet that can be inlined,
+// numbered from order, and the text of the ones that must be kept in a
+// <style> block, such as media queries.
+func parseStyleSheet(sheet string, order int) ([]cssRule, string) {
+	sheet = cssComment.ReplaceAllString(sheet, "")
+
+	var rules []cssRule
+	var kept []string
+	for {
+		sheet = strings.TrimSpace(sheet)
+		if sheet == "" {
+			break
+		}
+
+		if sheet[0] == '@' {
+			// Statements such as @import end at a semicolon and the others,
+			// such as @media, at the end of their block.
+			open := strings.IndexByte(sheet, '{')
+			semicolon := strings.IndexByte(sheet, ';')
+			end := len(sheet)
+			if semicolon >= 0 && (open < 0 || semicolon < open) {
+				end = semicolon + 1
+			} else if open >= 0 {
+				end = blockEnd(sheet, open)
+			}
+			kept = append(kept, strings.TrimSpace(sheet[:end]))
+			sheet = sheet[end:]
+			continue
+		}
+
+		open := strings.IndexByte(sheet, '{')
+		if open < 0 {
+			break
+		}
+		end := blockEnd(sheet, open)
+		selectors := sheet[:open]
+		body := strings.TrimSuffix(sheet[open+1:end], "}")
+		sheet = sheet[end:]
+
+		declarations := parseDeclarations(body)
+		var unsupported []string
+		for _, selector := range strings.Split(selectors, ",") {
+			selector = strings.TrimSpace(selector)
+			rule, ok := parseSelector(selector)
+			if !ok {
+				unsupported = append(unsupported, selector)
+				continue
+			}
+			rule.order = order
+			rule.declarations = declarations
+			rules = append(rules, rule)
+			order++
+		}
+		if len(unsupported) > 0 {
+			kept = append(kept, strings.Join(unsupported, ", ")+" {"+body+"}")
+		}
+	}
+	return rules, strings.Join(kept, "\n")
+}
+
+// blockEnd returns the position after the brace that closes the block opened
+// at open, ignoring the braces in strings.
+func blockEnd(s string, open int) int {
+	depth := 0
+	var quote byte
+	for i := open; i < len(s); i++ {
+		switch c := s[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '{':
+			depth++
+		case c == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return len(s)
+}
+
+// parseSelector parses a selector made of element, class and id selectors
+// combined by descendant combinators, such as ".email-body p".
+func parseSelector(selector string) (cssRule, bool) {
+	var rule cssRule
+	for _, part := range strings.Fields(selector) {
+		match := compoundSelectorPattern.FindStringSubmatch(part)
+		if match == nil {
+			return cssRule{}, false
+		}
+		compound := compoundSelector{element: strings.ToLower(match[1])}
+		if compound.element != "" {
+			rule.specificity[2]++
+		}
+		for _, simple := range simpleSelector.FindAllString(match[2], -1) {
+			if simple[0] == '#' {
+				compound.id = simple[1:]
+				rule.specificity[0]++
+			} else {
+				compound.classes = append(compound.classes, simple[1:])
+				rule.specificity[1]++
+			}
+		}
+		rule.selector = append(rule.selector, compound)
+	}
+	return rule, len(rule.selector) > 0
+}
+
+// parseDeclarations parses the declarations of a rule or of a style
+// attribute, such as "margin: 0; color: #333 !important".
+func parseDeclarations(body string) []cssDeclaration {
+	var declarations []cssDeclaration
+	for _, declaration := range splitDeclarations(body) {
+		property, value, found := strings.Cut(declaration, ":")
+		property = strings.ToLower(strings.TrimSpace(property))
+		value = strings.TrimSpace(value)
+		if !found || property == "" || value == "" {
+			continue
+		}
+
+		d := cssDeclaration{property: property, value: value}
+		if i := strings.LastIndexByte(value, '!'); i >= 0 && strings.EqualFold(strings.TrimSpace(value[i+1:]), "important") {
+			d.value = strings.TrimSpace(value[:i])
+			d.important = true
+		}
+		declarations = append(declarations, d)
+	}
+	return declarations
+}
+
+// splitDeclarations splits the declarations at the semicolons that are not
+// in strings or parentheses, such as the ones of url(data:image/png;base64,...).
+func splitDeclarations(body string) []string {
+	var declarations []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(body); i++ {
+		switch c := body[i]; {
+		case quote != 0:
+			if c == '\\' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+		case c == ';' && depth == 0:
+			declarations = append(declarations, body[start:i])
+			start = i + 1
+		}
+	}
+	return append(declarations, body[start:])
+}
@@ -0,0 +1,94 @@
+package mailer_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+func TestEmailTemplate_ExecuteInlineCSS(t *testing.T) {
+	layout := `<html><head><style>{{.CSS}}</style></head><body>{{block "content" .}}{{end}}</body></html>`
+
+	tests := map[string]struct {
+		css      string
+		body     string
+		contains []string
+		excludes []string
+	}{
+		"Element, Class And Id Selectors": {
+			css:  `p { margin: 0 } .note { color: red } #intro { font-size: 18px }`,
+			body: `<p class="note" id="intro">Hi</p>`,
+			contains: []string{
+				`<p class="note" id="intro" style="margin: 0; color: red; font-size: 18px;">Hi</p>`,
+				`<head></head>`,
+			},
+		},
+		"Descendant Selectors": {
+			css:      `.email-body p { margin: 10px 0 } .email-footer p { margin: 0 }`,
+			body:     `<div class="email-body"><div><p>Hi</p></div></div>`,
+			contains: []string{`<p style="margin: 10px 0;">Hi</p>`},
+		},
+		"Specificity Over Order": {
+			css:      `#cta { color: blue } a.button { color: green } .button { color: red } a { color: black }`,
+			body:     `<a class="button" id="cta">Go</a><a class="button">Go</a><a>Go</a>`,
+			contains: []string{`id="cta" style="color: blue;"`, `<a class="button" style="color: green;">`, `<a style="color: black;">`},
+		},
+		"Later Rules Win Ties": {
+			css:      `.a { color: red } .b { color: blue }`,
+			body:     `<span class="b a">Hi</span>`,
+			contains: []string{`style="color: blue;"`},
+		},
+		"Style Attribute Wins Unless Important": {
+			css:      `p { color: red; margin: 0 !important }`,
+			body:     `<p style="color: blue; margin: 5px">Hi</p>`,
+			contains: []string{`<p style="color: blue; margin: 0 !important;">Hi</p>`},
+		},
+		"Media Queries And Pseudo Classes Are Kept": {
+			css:  `a, a:hover { color: red } @media (max-width: 600px) { a { color: blue } }`,
+			body: `<a href="https://go.dev">Go</a>`,
+			contains: []string{
+				`<a href="https://go.dev" style="color: red;">Go</a>`,
+				"<style>a:hover { color: red }\n@media (max-width: 600px) { a { color: blue } }</style>",
+			},
+		},
+		"Comments And Data URIs": {
+			css:      `/* logo */ .logo { background: url(data:image/png;base64,AAAA) no-repeat }`,
+			body:     `<div class="logo"></div>`,
+			contains: []string{`style="background: url(data:image/png;base64,AAAA) no-repeat;"`},
+			excludes: []string{"logo */"},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "layout.html", layout)
+			createTempFile(t, tmpDir, "styles.css", tt.css)
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+
+			emailTemplate, err := mailer.NewEmailTemplateBuilder(tmpDir, "body1.html", "http://golang.samba.br").
+				WithInlineCSS(true).
+				Build()
+			if err != nil {
+				t.Fatalf("Failed to create EmailTemplate: %v", err)
+			}
+
+			result, err := emailTemplate.Execute(nil)
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(result, want) {
+					t.Errorf("Execute() result = %v, expected it to contain %v", result, want)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(result, unwanted) {
+					t.Errorf("Execute() result = %v, expected it not to contain %v", result, unwanted)
+				}
+			}
+		})
+	}
+}
@@ -1,43 +1,106 @@
 package mailer
 
 import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
 	"fmt"
+	"net"
 	"net/mail"
 	"net/smtp"
+	"net/textproto"
 	"os"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/reneepc/gopher-lite-mailer/metrics"
+	"github.com/reneepc/gopher-lite-mailer/tracing"
 )
 
+// ErrAuthFailed is returned when the SMTP server rejects the credentials.
+var ErrAuthFailed = errors.New("authentication failed")
+
 type Mailer struct {
 	server        string
+	host          string
 	from          string
+	displayName   string
+	replyTo       string
 	auth          smtp.Auth
+	tlsMode       TLSMode
 	customHeaders map[string]string
 	attachments   []Attachment
 }
 
 type Attachment struct {
-	FileName     string
-	ContentType  string
-	Base64Encode bool
-	ContentID    string
+	FileName     string `yaml:"file"`
+	ContentType  string `yaml:"content_type"`
+	Base64Encode bool   `yaml:"base64"`
+	ContentID    string `yaml:"content_id"`
+}
+
+// Email is a rendered email.
+type Email struct {
+	Subject string
+	Body    string
+	// From replaces the From header of the mailer when not empty. The email
+	// is still sent with the account of the mailer.
+	From string
+	// Attachments are sent in addition to the ones of the mailer.
+	Attachments []Attachment
 }
 
 func (m Mailer) SendMail(to, subject string, data string) error {
-	recipient, err := mail.ParseAddress(to)
+	_, err := m.deliver(context.Background(), []string{to}, Email{Subject: subject, Body: data})
+	return err
+}
+
+// deliver builds the message with the headers and attachments of the mailer
+// plus the ones of the email, and sends it to every recipient.
+func (m Mailer) deliver(ctx context.Context, to []string, email Email) (Result, error) {
+	if len(to) == 0 {
+		return Result{}, errors.New("at least one recipient is required")
+	}
+
+	recipients := make([]string, len(to))
+	for i, address := range to {
+		recipient, err := mail.ParseAddress(address)
+		if err != nil {
+			return Result{}, fmt.Errorf("invalid recipient: %v", err)
+		}
+		recipients[i] = recipient.Address
+	}
+
+	messageID, err := m.newMessageID()
 	if err != nil {
-		return fmt.Errorf("invalid recipient: %v", err)
+		return Result{}, err
+	}
+
+	from := m.fromHeader()
+	if email.From != "" {
+		from = email.From
 	}
 
 	headers := map[string]string{
-		"From":         m.from,
-		"To":           recipient.Address,
-		"Subject":      subject,
+		"From":         from,
+		"To":           strings.Join(recipients, ", "),
+		"Subject":      email.Subject,
+		"Message-ID":   messageID,
 		"MIME-Version": "1.0",
 	}
 
-	if len(m.attachments) > 0 {
+	if m.replyTo != "" {
+		headers["Reply-To"] = m.replyTo
+	}
+
+	attachments := append(append([]Attachment(nil), m.attachments...), email.Attachments...)
+	if len(attachments) > 0 {
 		headers["Content-Type"] = "multipart/related; boundary=boundary"
 	} else {
 		headers["Content-Type"] = "text/html; charset=\"UTF-8\""
@@ -48,30 +111,201 @@ func (m Mailer) SendMail(to, subject string, data string) error {
 	}
 
 	var msg string
-	if len(m.attachments) > 0 {
-		msg, err = m.buildMultipartEmail(data, headers)
+	if len(attachments) > 0 {
+		msg, err = buildMultipartEmail(email.Body, headers, attachments)
 		if err != nil {
-			return fmt.Errorf("error building multipart email: %v", err)
+			return Result{}, fmt.Errorf("error building multipart email: %v", err)
 		}
 	} else {
-		msg = m.buildSimpleEmail(data, headers)
+		msg = m.buildSimpleEmail(email.Body, headers)
+	}
+
+	ctx, span := tracing.Tracer().Start(ctx, "send", trace.WithAttributes(
+		attribute.String("smtp.server", m.server),
+		attribute.String("account", m.from),
+		attribute.String("message_id", messageID),
+	))
+	code, response, err := m.send(ctx, recipients, []byte(msg))
+	// A cancelled context closes the connection, so the error is reported as
+	// the cancellation. An email the server accepted is never reported as
+	// failed, even if the context was cancelled after it.
+	if err != nil && ctx.Err() != nil {
+		err = ctx.Err()
+	}
+	span.SetAttributes(attribute.Int("smtp_code", code))
+	tracing.End(span, err)
+	if err != nil {
+		metrics.MessagesFailed.WithLabelValues(m.from, failureReason(err)).Inc()
+		return Result{}, fmt.Errorf("error sending mail: %w", err)
+	}
+	metrics.MessagesSent.WithLabelValues(m.from).Inc()
+
+	return Result{MessageID: messageID, Code: code, Response: response}, nil
+}
+
+// send delivers the message over a new connection, securing it according to
+// the TLS mode before authenticating. It returns the reply of the server to
+// the message. The connection is closed when the context is done.
+func (m Mailer) send(ctx context.Context, to []string, msg []byte) (int, string, error) {
+	// phase observes the duration of each step of the session that succeeded,
+	// and traces it as a child of the send span.
+	start := time.Now()
+	phase := func(name string) {
+		now := time.Now()
+		metrics.SMTPDuration.WithLabelValues(name).Observe(now.Sub(start).Seconds())
+		_, span := tracing.Tracer().Start(ctx, name, trace.WithTimestamp(start))
+		span.End(trace.WithTimestamp(now))
+		start = now
+	}
+
+	tlsConfig := &tls.Config{ServerName: m.host}
+
+	var conn net.Conn
+	var err error
+	if m.tlsMode == TLSModeImplicit {
+		dialer := &tls.Dialer{Config: tlsConfig}
+		conn, err = dialer.DialContext(ctx, "tcp", m.server)
+	} else {
+		var dialer net.Dialer
+		conn, err = dialer.DialContext(ctx, "tcp", m.server)
+	}
+	if err != nil {
+		return 0, "", err
+	}
+	stop := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stop()
+
+	client, err := smtp.NewClient(conn, m.host)
+	if err != nil {
+		conn.Close()
+		return 0, "", err
+	}
+	defer client.Close()
+
+	if err = client.Hello("localhost"); err != nil {
+		return 0, "", err
 	}
+	phase("connect")
 
-	err = smtp.SendMail(
-		m.server,
-		m.auth,
-		m.from,
-		[]string{recipient.Address},
-		[]byte(msg),
-	)
+	if m.tlsMode == TLSModeStartTLS {
+		if ok, _ := client.Extension("STARTTLS"); !ok {
+			return 0, "", fmt.Errorf("server %s does not support STARTTLS", m.server)
+		}
+		if err = client.StartTLS(tlsConfig); err != nil {
+			return 0, "", err
+		}
+		phase("starttls")
+	}
+
+	if m.auth != nil {
+		if ok, _ := client.Extension("AUTH"); !ok {
+			return 0, "", fmt.Errorf("server %s does not support AUTH", m.server)
+		}
+		if err = client.Auth(m.auth); err != nil {
+			return 0, "", fmt.Errorf("%w: %w", ErrAuthFailed, err)
+		}
+		phase("auth")
+	}
+
+	if err = client.Mail(m.from); err != nil {
+		return 0, "", err
+	}
+	for _, recipient := range to {
+		if err = client.Rcpt(recipient); err != nil {
+			return 0, "", err
+		}
+	}
+	phase("envelope")
+
+	code, response, err := data(client.Text, msg)
+	if err != nil {
+		return 0, "", err
+	}
+	phase("data")
+
+	// The server accepted the message, so a failure to end the session, such
+	// as the connection closed by a cancelled context, does not fail it.
+	if err := client.Quit(); err == nil {
+		phase("quit")
+	}
+	return code, response, nil
+}
+
+// failureReason classifies a send error for the failed messages metric.
+func failureReason(err error) string {
+	var smtpErr *textproto.Error
+	var netErr net.Error
+	switch {
+	case errors.Is(err, ErrAuthFailed):
+		return "auth"
+	case IsQuotaExceeded(err):
+		return "quota"
+	case errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded):
+		return "canceled"
+	case errors.As(err, &smtpErr) && smtpErr.Code >= 500:
+		return "rejected"
+	case errors.As(err, &smtpErr) && smtpErr.Code >= 400:
+		return "temporary"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
+
+// data sends the message with the DATA command. Unlike smtp.Client.Data, it
+// returns the reply of the server to the message, which usually has the id
+// the server queued it with.
+func data(text *textproto.Conn, msg []byte) (int, string, error) {
+	id, err := text.Cmd("DATA")
+	if err != nil {
+		return 0, "", err
+	}
+	text.StartResponse(id)
+	_, _, err = text.ReadResponse(354)
+	text.EndResponse(id)
 	if err != nil {
-		return fmt.Errorf("error sending mail: %v", err)
+		return 0, "", err
+	}
+
+	w := text.DotWriter()
+	if _, err := w.Write(msg); err != nil {
+		return 0, "", err
+	}
+	if err := w.Close(); err != nil {
+		return 0, "", err
+	}
+
+	return text.ReadResponse(250)
+}
+
+// newMessageID returns a unique Message-ID header value in the domain of the
+// sender.
+func (m Mailer) newMessageID() (string, error) {
+	random := make([]byte, 16)
+	if _, err := rand.Read(random); err != nil {
+		return "", fmt.Errorf("could not create message id: %v", err)
 	}
 
-	return nil
+	domain := "localhost"
+	if _, after, found := strings.Cut(m.from, "@"); found && after != "" {
+		domain = after
+	}
+	return fmt.Sprintf("<%s@%s>", hex.EncodeToString(random), domain), nil
+}
+
+// From returns the address the emails are sent from.
+func (m Mailer) From() string {
+	return m.from
+}
+
+func (m Mailer) fromHeader() string {
+	if m.displayName == "" {
+		return m.from
+	}
+	return (&mail.Address{Name: m.displayName, Address: m.from}).String()
 }
 
-func (m Mailer) buildMultipartEmail(data string, headers map[string]string) (string, error) {
+func buildMultipartEmail(data string, headers map[string]string, attachments []Attachment) (string, error) {
 	var msg strings.Builder
 	msg.WriteString(buildHeaders(headers))
 
@@ -79,7 +313,7 @@ func (m Mailer) buildMultipartEmail(data string, headers map[string]string) (str
 	msg.WriteString("Content-Type: text/html; charset=\"UTF-8\"\r\n")
 	msg.WriteString(data)
 
-	for _, attachment := range m.attachments {
+	for _, attachment := range attachments {
 		attachmentPart, err := attachment.buildPart()
 		if err != nil {
 			return "", fmt.Errorf("could not build attachment part: %v", err)
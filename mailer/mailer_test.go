@@ -0,0 +1,275 @@
+package mailer_test
+
+import (
+	"bufio"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/metrics"
+)
+
+// fakeSMTPServer is a minimal SMTP server without TLS that records the
+// messages it receives. authReply and rcptReply, when set, replace the
+// successful replies to AUTH and RCPT TO. rcptReplies replace the replies to
+// the first RCPT TO commands, one each. onQuit, when set, is called when
+// QUIT is received, before replying, and onData when a message is received,
+// before accepting it.
+type fakeSMTPServer struct {
+	listener  net.Listener
+	authReply string
+	rcptReply string
+	onQuit    func()
+	onData    func()
+
+	mu          sync.Mutex
+	rcptReplies []string
+	auth        []string
+	messages    []string
+}
+
+func newFakeSMTPServer(t *testing.T) *fakeSMTPServer {
+	t.Helper()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	server := &fakeSMTPServer{listener: listener}
+	go server.serve()
+	return server
+}
+
+func (s *fakeSMTPServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *fakeSMTPServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *fakeSMTPServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { fmt.Fprintf(conn, "%s\r\n", line) }
+	readLine := func() (string, bool) {
+		line, err := reader.ReadString('\n')
+		return strings.TrimRight(line, "\r\n"), err == nil
+	}
+
+	reply("220 localhost ESMTP")
+	for {
+		line, ok := readLine()
+		if !ok {
+			return
+		}
+
+		command := strings.ToUpper(line)
+		switch {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN LOGIN")
+		case strings.HasPrefix(command, "AUTH") && s.authReply != "":
+			reply(s.authReply)
+		case strings.HasPrefix(command, "AUTH PLAIN"):
+			s.recordAuth("PLAIN")
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(command, "AUTH LOGIN"):
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Username:")))
+			readLine()
+			reply("334 " + base64.StdEncoding.EncodeToString([]byte("Password:")))
+			readLine()
+			s.recordAuth("LOGIN")
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(command, "MAIL FROM"):
+			reply("250 2.1.0 OK")
+		case strings.HasPrefix(command, "RCPT TO"):
+			if next, ok := s.nextRcptReply(); ok {
+				reply(next)
+			} else if s.rcptReply != "" {
+				reply(s.rcptReply)
+			} else {
+				reply("250 2.1.5 OK")
+			}
+		case command == "DATA":
+			reply("354 Go ahead")
+			var data strings.Builder
+			for {
+				dataLine, ok := readLine()
+				if !ok || dataLine == "." {
+					break
+				}
+				data.WriteString(dataLine + "\n")
+			}
+			if s.onData != nil {
+				s.onData()
+			}
+			s.recordMessage(data.String())
+			reply("250 2.0.0 OK queued")
+		case command == "QUIT":
+			if s.onQuit != nil {
+				s.onQuit()
+			}
+			reply("221 2.0.0 Bye")
+			return
+		default:
+			reply("502 5.5.2 Command not implemented")
+		}
+	}
+}
+
+func (s *fakeSMTPServer) nextRcptReply() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.rcptReplies) == 0 {
+		return "", false
+	}
+	next := s.rcptReplies[0]
+	s.rcptReplies = s.rcptReplies[1:]
+	return next, true
+}
+
+func (s *fakeSMTPServer) messageCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.messages)
+}
+
+func (s *fakeSMTPServer) recordAuth(mechanism string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.auth = append(s.auth, mechanism)
+}
+
+func (s *fakeSMTPServer) recordMessage(message string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, message)
+}
+
+func TestMailer_SendMail(t *testing.T) {
+	tests := map[string]struct {
+		configure       func(b mailer.MailerBuilder) mailer.MailerBuilder
+		rcptReply       string
+		expectedAuth    []string
+		expectedHeaders []string
+		expectError     bool
+	}{
+		"Plain Auth": {
+			configure:       func(b mailer.MailerBuilder) mailer.MailerBuilder { return b },
+			expectedAuth:    []string{"PLAIN"},
+			expectedHeaders: []string{"From: user@example.com", "To: rene@example.com", "Subject: Olá"},
+		},
+		"Login Auth": {
+			configure: func(b mailer.MailerBuilder) mailer.MailerBuilder {
+				return b.WithAuthMethod(mailer.AuthLogin)
+			},
+			expectedAuth: []string{"LOGIN"},
+		},
+		"No Auth": {
+			configure: func(b mailer.MailerBuilder) mailer.MailerBuilder {
+				return b.WithAuthMethod(mailer.AuthNone)
+			},
+		},
+		"Display Name and Reply-To": {
+			configure: func(b mailer.MailerBuilder) mailer.MailerBuilder {
+				return b.WithDisplayName("Golang SP").WithReplyTo("contato@golang.sampa.br")
+			},
+			expectedAuth:    []string{"PLAIN"},
+			expectedHeaders: []string{`From: "Golang SP" <user@example.com>`, "Reply-To: contato@golang.sampa.br"},
+		},
+		"Rejected Recipient": {
+			configure:   func(b mailer.MailerBuilder) mailer.MailerBuilder { return b },
+			rcptReply:   "550 5.1.1 User unknown",
+			expectError: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newFakeSMTPServer(t)
+			server.rcptReply = tt.rcptReply
+
+			builder := mailer.NewMailerBuilder("127.0.0.1", server.port(), "user@example.com", "password").
+				WithTLSMode(mailer.TLSModeNone)
+			m := tt.configure(builder).Build()
+
+			err := m.SendMail("rene@example.com", "Olá", "<p>Olá</p>")
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error = %v, got %v", tt.expectError, err)
+			}
+			if tt.expectError {
+				return
+			}
+
+			server.mu.Lock()
+			defer server.mu.Unlock()
+
+			if strings.Join(server.auth, ",") != strings.Join(tt.expectedAuth, ",") {
+				t.Errorf("expected auth %v, got %v", tt.expectedAuth, server.auth)
+			}
+			if len(server.messages) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(server.messages))
+			}
+			for _, header := range tt.expectedHeaders {
+				if !strings.Contains(server.messages[0], header+"\n") {
+					t.Errorf("expected header %q in message:\n%s", header, server.messages[0])
+				}
+			}
+		})
+	}
+}
+
+func TestMailer_SendMailRequiresStartTLS(t *testing.T) {
+	server := newFakeSMTPServer(t)
+
+	m := mailer.NewMailerBuilder("127.0.0.1", server.port(), "user@example.com", "password").Build()
+
+	err := m.SendMail("rene@example.com", "Olá", "<p>Olá</p>")
+	if err == nil || !strings.Contains(err.Error(), "STARTTLS") {
+		t.Errorf("expected STARTTLS error, got %v", err)
+	}
+}
+
+func TestMailer_SendMailMetrics(t *testing.T) {
+	send := func(rcptReply string) error {
+		server := newFakeSMTPServer(t)
+		server.rcptReply = rcptReply
+		m := mailer.NewMailerBuilder("127.0.0.1", server.port(), "metrics@example.com", "password").
+			WithTLSMode(mailer.TLSModeNone).
+			Build()
+		return m.SendMail("rene@example.com", "Olá", "<p>Olá</p>")
+	}
+
+	if err := send(""); err != nil {
+		t.Fatalf("Failed to send email: %v", err)
+	}
+	if err := send("550 5.1.1 User unknown"); err == nil {
+		t.Fatal("expected the recipient to be rejected")
+	}
+
+	if sent := testutil.ToFloat64(metrics.MessagesSent.WithLabelValues("metrics@example.com")); sent != 1 {
+		t.Errorf("expected 1 sent message, got %v", sent)
+	}
+	if failed := testutil.ToFloat64(metrics.MessagesFailed.WithLabelValues("metrics@example.com", "rejected")); failed != 1 {
+		t.Errorf("expected 1 rejected message, got %v", failed)
+	}
+	if phases := testutil.CollectAndCount(metrics.SMTPDuration); phases < 5 {
+		t.Errorf("expected the connect, auth, envelope, data and quit phases, got %d", phases)
+	}
+}
@@ -0,0 +1,270 @@
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/textproto"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/logging"
+)
+
+// ErrNoAccountAvailable is returned by Pool.SendMail when every account has
+// reached its quota or was disabled by an authentication error.
+var ErrNoAccountAvailable = errors.New("no sender account available")
+
+// Account is a Mailer identified by a name, usually its profile, that can send
+// at most DailyQuota emails. A zero DailyQuota means no limit.
+type Account struct {
+	Name       string
+	Mailer     Mailer
+	DailyQuota int
+}
+
+type poolAccount struct {
+	Account
+	sent     int
+	pending  int
+	disabled error
+}
+
+// QuotaTracker keeps the usage of the accounts across runs. Accounts are
+// identified by their sender address, so profiles sharing an address share
+// their quota.
+type QuotaTracker interface {
+	Used(account string) int
+	ResetAt(account string, limit int) time.Time
+	Record(account string) error
+}
+
+// QuotaError is returned by Pool.SendMail when the accounts that are still
+// enabled reached their quota. RetryAt is when the first of them can send
+// again, or the zero time when unknown.
+type QuotaError struct {
+	RetryAt time.Time
+}
+
+func (e *QuotaError) Error() string {
+	if e.RetryAt.IsZero() {
+		return "daily quota reached by every sender account"
+	}
+	return fmt.Sprintf("daily quota reached by every sender account, next email can be sent at %s", e.RetryAt.Format(time.DateTime))
+}
+
+func (e *QuotaError) Is(target error) bool {
+	return target == ErrNoAccountAvailable
+}
+
+// Pool distributes emails across several accounts in turn. When an account
+// reaches its quota, or the server reports it exceeded its quota or rejects
+// its credentials, the account is left out and the email is sent by the next
+// one.
+type Pool struct {
+	mu       sync.Mutex
+	accounts []*poolAccount
+	next     int
+	tracker  QuotaTracker
+}
+
+func NewPool(accounts ...Account) *Pool {
+	pool := &Pool{}
+	for _, account := range accounts {
+		pool.accounts = append(pool.accounts, &poolAccount{Account: account})
+	}
+	return pool
+}
+
+// WithQuotaTracker makes the pool count the usage of its accounts with the
+// tracker instead of only the emails sent by the pool itself.
+func (p *Pool) WithQuotaTracker(tracker QuotaTracker) *Pool {
+	p.tracker = tracker
+	return p
+}
+
+// SendMail sends the email through the next available account and returns
+// the name of the account that sent it.
+func (p *Pool) SendMail(to, subject, data string) (string, error) {
+	return p.SendEmail(to, Email{Subject: subject, Body: data})
+}
+
+// SendEmail is like SendMail for an email rendered with EmailTemplate.Render.
+func (p *Pool) SendEmail(to string, email Email) (string, error) {
+	account, _, err := p.send(context.Background(), to, email)
+	return account, err
+}
+
+// send is like SendMail, also returning the reply of the server.
+func (p *Pool) send(ctx context.Context, to string, email Email) (string, Result, error) {
+	for {
+		account, err := p.acquire()
+		if err != nil {
+			return "", Result{}, err
+		}
+
+		result, err := account.Mailer.deliver(ctx, []string{to}, email)
+		if err == nil {
+			p.record(account)
+			return account.Name, result, nil
+		}
+
+		if !p.failover(account, err) {
+			p.release(account)
+			return account.Name, Result{}, err
+		}
+	}
+}
+
+// acquire reserves one email of the quota of the next available account.
+func (p *Pool) acquire() (*poolAccount, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var quotaErr *QuotaError
+	for i := range p.accounts {
+		account := p.accounts[(p.next+i)%len(p.accounts)]
+		if account.disabled != nil {
+			continue
+		}
+
+		if account.DailyQuota > 0 && p.used(account) >= account.DailyQuota {
+			retryAt := p.resetAt(account)
+			if quotaErr == nil || (!retryAt.IsZero() && (quotaErr.RetryAt.IsZero() || retryAt.Before(quotaErr.RetryAt))) {
+				quotaErr = &QuotaError{RetryAt: retryAt}
+			}
+			continue
+		}
+
+		account.pending++
+		p.next = (p.next + i + 1) % len(p.accounts)
+		return account, nil
+	}
+
+	if quotaErr != nil {
+		return nil, quotaErr
+	}
+	return nil, ErrNoAccountAvailable
+}
+
+// used returns the emails counted against the quota of the account, including
+// the ones being sent. Callers must hold mu.
+func (p *Pool) used(account *poolAccount) int {
+	if p.tracker != nil {
+		return p.tracker.Used(account.Mailer.From()) + account.pending
+	}
+	return account.sent + account.pending
+}
+
+// resetAt returns when the account can send again. Callers must hold mu.
+func (p *Pool) resetAt(account *poolAccount) time.Time {
+	if p.tracker == nil {
+		return time.Time{}
+	}
+	return p.tracker.ResetAt(account.Mailer.From(), max(account.DailyQuota-account.pending, 1))
+}
+
+// record counts an email sent by the account.
+func (p *Pool) record(account *poolAccount) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	account.pending--
+	account.sent++
+	if p.tracker != nil {
+		if err := p.tracker.Record(account.Mailer.From()); err != nil {
+			slog.Warn("could not record quota usage", slog.String(logging.KeyAccount, account.Name), slog.Any("error", err))
+		}
+	}
+}
+
+// release gives back the quota reserved for an email that was not sent.
+func (p *Pool) release(account *poolAccount) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	account.pending--
+}
+
+// failover disables the account when the error means it can no longer send,
+// and reports whether the email should be retried with another account.
+func (p *Pool) failover(account *poolAccount, err error) bool {
+	if !IsQuotaExceeded(err) && !errors.Is(err, ErrAuthFailed) {
+		return false
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	account.pending--
+	account.disabled = err
+	return true
+}
+
+// Remaining returns how many more emails the enabled accounts can send before
+// reaching their quotas, or -1 when at least one of them has no quota.
+func (p *Pool) Remaining() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	remaining := 0
+	for _, account := range p.accounts {
+		if account.disabled != nil {
+			continue
+		}
+		if account.DailyQuota == 0 {
+			return -1
+		}
+		remaining += max(account.DailyQuota-p.used(account), 0)
+	}
+	return remaining
+}
+
+// Accounts returns the name of every account in the pool with the number of
+// emails it sent and, when disabled, the reason.
+func (p *Pool) Accounts() []AccountStatus {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	statuses := make([]AccountStatus, 0, len(p.accounts))
+	for _, account := range p.accounts {
+		statuses = append(statuses, AccountStatus{
+			Name:     account.Name,
+			Sent:     account.sent,
+			Disabled: account.disabled,
+		})
+	}
+	return statuses
+}
+
+type AccountStatus struct {
+	Name     string
+	Sent     int
+	Disabled error
+}
+
+func (s AccountStatus) String() string {
+	if s.Disabled != nil {
+		return fmt.Sprintf("%s: %d sent, disabled: %v", s.Name, s.Sent, s.Disabled)
+	}
+	return fmt.Sprintf("%s: %d sent", s.Name, s.Sent)
+}
+
+// IsQuotaExceeded reports whether the SMTP server rejected the email because
+// the account exceeded its sending limit, such as Gmail's
+// "550 5.4.5 Daily user sending limit exceeded".
+func IsQuotaExceeded(err error) bool {
+	var smtpErr *textproto.Error
+	if !errors.As(err, &smtpErr) {
+		return false
+	}
+
+	msg := strings.ToLower(smtpErr.Msg)
+	switch smtpErr.Code {
+	case 550, 552, 554:
+		return strings.HasPrefix(msg, "5.4.5") || strings.Contains(msg, "quota") || strings.Contains(msg, "limit exceeded")
+	case 421, 451, 452:
+		return strings.Contains(msg, "quota") || strings.Contains(msg, "limit exceeded")
+	}
+	return false
+}
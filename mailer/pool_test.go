@@ -0,0 +1,195 @@
+package mailer_test
+
+import (
+	"errors"
+	"fmt"
+	"net/textproto"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+func newTestAccount(t *testing.T, name string, server *fakeSMTPServer, dailyQuota int) mailer.Account {
+	t.Helper()
+
+	return mailer.Account{
+		Name: name,
+		Mailer: mailer.NewMailerBuilder("127.0.0.1", server.port(), name+"@example.com", "password").
+			WithTLSMode(mailer.TLSModeNone).
+			Build(),
+		DailyQuota: dailyQuota,
+	}
+}
+
+func TestPool_SendMail(t *testing.T) {
+	tests := map[string]struct {
+		authReply        [2]string
+		rcptReply        [2]string
+		quotas           [2]int
+		emails           int
+		expectedAccounts []string
+		expectedCounts   [2]int
+		expectedErrors   int
+	}{
+		"Round Robin": {
+			emails:           4,
+			expectedAccounts: []string{"first", "second", "first", "second"},
+			expectedCounts:   [2]int{2, 2},
+		},
+		"Daily Quota": {
+			quotas:           [2]int{1, 0},
+			emails:           3,
+			expectedAccounts: []string{"first", "second", "second"},
+			expectedCounts:   [2]int{1, 2},
+		},
+		"All Quotas Reached": {
+			quotas:           [2]int{1, 1},
+			emails:           3,
+			expectedAccounts: []string{"first", "second", ""},
+			expectedCounts:   [2]int{1, 1},
+			expectedErrors:   1,
+		},
+		"Failover on Quota Exceeded": {
+			rcptReply:        [2]string{"550 5.4.5 Daily user sending limit exceeded", ""},
+			emails:           2,
+			expectedAccounts: []string{"second", "second"},
+			expectedCounts:   [2]int{0, 2},
+		},
+		"Failover on Auth Error": {
+			authReply:        [2]string{"", "535 5.7.8 Username and Password not accepted"},
+			emails:           2,
+			expectedAccounts: []string{"first", "first"},
+			expectedCounts:   [2]int{2, 0},
+		},
+		"No Failover on Rejected Recipient": {
+			rcptReply:        [2]string{"550 5.1.1 User unknown", ""},
+			emails:           2,
+			expectedAccounts: []string{"first", "second"},
+			expectedCounts:   [2]int{0, 1},
+			expectedErrors:   1,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			var servers [2]*fakeSMTPServer
+			var accounts []mailer.Account
+			for i, accountName := range []string{"first", "second"} {
+				servers[i] = newFakeSMTPServer(t)
+				servers[i].authReply = tt.authReply[i]
+				servers[i].rcptReply = tt.rcptReply[i]
+				accounts = append(accounts, newTestAccount(t, accountName, servers[i], tt.quotas[i]))
+			}
+			pool := mailer.NewPool(accounts...)
+
+			var errs int
+			for i := 0; i < tt.emails; i++ {
+				account, err := pool.SendMail(fmt.Sprintf("rene%d@example.com", i), "Olá", "<p>Olá</p>")
+				if err != nil {
+					errs++
+				}
+				if account != tt.expectedAccounts[i] {
+					t.Errorf("email %d: expected account %q, got %q (error %v)", i, tt.expectedAccounts[i], account, err)
+				}
+			}
+
+			if errs != tt.expectedErrors {
+				t.Errorf("expected %d errors, got %d", tt.expectedErrors, errs)
+			}
+			for i, server := range servers {
+				if server.messageCount() != tt.expectedCounts[i] {
+					t.Errorf("server %d: expected %d messages, got %d", i, tt.expectedCounts[i], server.messageCount())
+				}
+			}
+		})
+	}
+}
+
+func TestIsQuotaExceeded(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"Gmail Daily Limit": {
+			err:      &textproto.Error{Code: 550, Msg: "5.4.5 Daily user sending limit exceeded."},
+			expected: true,
+		},
+		"Wrapped": {
+			err:      fmt.Errorf("error sending mail: %w", &textproto.Error{Code: 550, Msg: "5.4.5 Daily sending quota exceeded"}),
+			expected: true,
+		},
+		"Temporary Quota": {
+			err:      &textproto.Error{Code: 452, Msg: "4.5.3 Sending quota exceeded"},
+			expected: true,
+		},
+		"Unknown User": {
+			err:      &textproto.Error{Code: 550, Msg: "5.1.1 User unknown"},
+			expected: false,
+		},
+		"Not an SMTP Error": {
+			err:      errors.New("connection refused"),
+			expected: false,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := mailer.IsQuotaExceeded(tt.err); got != tt.expected {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+type fakeQuotaTracker struct {
+	used    map[string]int
+	resetAt time.Time
+}
+
+func (f *fakeQuotaTracker) Used(account string) int { return f.used[account] }
+
+func (f *fakeQuotaTracker) ResetAt(string, int) time.Time { return f.resetAt }
+
+func (f *fakeQuotaTracker) Record(account string) error {
+	f.used[account]++
+	return nil
+}
+
+func TestPool_SendMailWithQuotaTracker(t *testing.T) {
+	first, second := newFakeSMTPServer(t), newFakeSMTPServer(t)
+	resetAt := time.Date(2024, 8, 6, 8, 0, 0, 0, time.UTC)
+	tracker := &fakeQuotaTracker{
+		used:    map[string]int{"first@example.com": 2, "second@example.com": 1},
+		resetAt: resetAt,
+	}
+
+	pool := mailer.NewPool(
+		newTestAccount(t, "first", first, 2),
+		newTestAccount(t, "second", second, 2),
+	).WithQuotaTracker(tracker)
+
+	if remaining := pool.Remaining(); remaining != 1 {
+		t.Errorf("expected 1 remaining email, got %d", remaining)
+	}
+
+	account, err := pool.SendMail("rene@example.com", "Olá", "<p>Olá</p>")
+	if err != nil || account != "second" {
+		t.Fatalf("expected email sent by second, got %q (error %v)", account, err)
+	}
+	if tracker.used["second@example.com"] != 2 {
+		t.Errorf("expected usage recorded in tracker, got %v", tracker.used)
+	}
+
+	_, err = pool.SendMail("jorge@example.com", "Olá", "<p>Olá</p>")
+	var quotaErr *mailer.QuotaError
+	if !errors.As(err, &quotaErr) || !quotaErr.RetryAt.Equal(resetAt) {
+		t.Fatalf("expected quota error with retry at %v, got %v", resetAt, err)
+	}
+	if !errors.Is(err, mailer.ErrNoAccountAvailable) {
+		t.Errorf("expected quota error to match ErrNoAccountAvailable")
+	}
+	if first.messageCount() != 0 || second.messageCount() != 1 {
+		t.Errorf("expected only one email sent, got %d and %d", first.messageCount(), second.messageCount())
+	}
+}
@@ -0,0 +1,72 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+)
+
+// TemplateRef points to a body template and the directory with its header,
+// footer and styles, as used by NewEmailTemplate.
+type TemplateRef struct {
+	Dir       string
+	Body      string
+	Signature string
+	// Locale is the language of the dates, DefaultLocale when empty.
+	Locale string
+	// Funcs are added to the functions available to the template.
+	Funcs template.FuncMap
+	// Strict fails the rendering when the template references a field
+	// missing from Data.
+	Strict bool
+	// InlineCSS moves the CSS rules into the style attributes of the
+	// elements.
+	InlineCSS bool
+}
+
+// Message is an email rendered from a template.
+type Message struct {
+	To       []string
+	Subject  string
+	Template TemplateRef
+	Data     map[string]string
+	// Attachments are sent in addition to the ones of the mailer.
+	Attachments []Attachment
+}
+
+// Result describes an email accepted by the SMTP server.
+type Result struct {
+	// MessageID is the value of the Message-ID header of the email.
+	MessageID string
+	// Code and Response are the reply of the server to the email, such as
+	// 250 and "2.0.0 OK 1723000000 queued as 12345".
+	Code     int
+	Response string
+}
+
+// Send renders the template of the message with its data and sends it to
+// every recipient in a single SMTP transaction. The subject, when empty, and
+// the sender and attachments come from the front matter of the body. The
+// connection is closed when the context is done.
+func (m Mailer) Send(ctx context.Context, msg Message) (Result, error) {
+	builder := NewEmailTemplateBuilder(msg.Template.Dir, msg.Template.Body, msg.Template.Signature).
+		WithFuncs(msg.Template.Funcs).
+		WithStrict(msg.Template.Strict).
+		WithInlineCSS(msg.Template.InlineCSS).
+		WithSubject(msg.Subject)
+	if msg.Template.Locale != "" {
+		builder = builder.WithLocale(msg.Template.Locale)
+	}
+	template, err := builder.Build()
+	if err != nil {
+		return Result{}, fmt.Errorf("could not create email template: %v", err)
+	}
+
+	email, err := template.Render(ctx, msg.Data)
+	if err != nil {
+		return Result{}, err
+	}
+	email.Attachments = append(email.Attachments, msg.Attachments...)
+
+	return m.deliver(ctx, msg.To, email)
+}
@@ -0,0 +1,142 @@
+package mailer_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+func TestMailer_Send(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	m := mailer.NewMailerBuilder("127.0.0.1", server.port(), "golangsp@example.com", "password").
+		WithTLSMode(mailer.TLSModeNone).
+		WithAuthMethod(mailer.AuthNone).
+		Build()
+
+	templateDir := t.TempDir()
+	createTempFile(t, templateDir, "header.html", "<html>")
+	createTempFile(t, templateDir, "footer.html", "</html>")
+	createTempFile(t, filepath.Join(templateDir, "bodies"), "hello.html", "<p>Olá, {{ .Data.Nome }}!</p>")
+	attachment := createTempFile(t, t.TempDir(), "logo.png", "png")
+
+	msg := mailer.Message{
+		To:          []string{"gopher@example.com", "Ferris <ferris@example.com>"},
+		Subject:     "Confirmação",
+		Template:    mailer.TemplateRef{Dir: templateDir, Body: "hello.html"},
+		Data:        map[string]string{"Nome": "Gopher"},
+		Attachments: []mailer.Attachment{{FileName: attachment, ContentType: "image/png", ContentID: "logo", Base64Encode: true}},
+	}
+
+	result, err := m.Send(context.Background(), msg)
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	if result.Code != 250 || result.Response != "2.0.0 OK queued" {
+		t.Errorf("unexpected server response: %d %s", result.Code, result.Response)
+	}
+	if !strings.HasPrefix(result.MessageID, "<") || !strings.HasSuffix(result.MessageID, "@example.com>") {
+		t.Errorf("unexpected message id %q", result.MessageID)
+	}
+
+	if server.messageCount() != 1 {
+		t.Fatalf("expected 1 message, got %d", server.messageCount())
+	}
+	message := server.messages[0]
+	for _, expected := range []string{
+		"Message-ID: " + result.MessageID + "\n",
+		"To: gopher@example.com, ferris@example.com\n",
+		"<p>Olá, Gopher!</p>",
+		"Content-ID: <logo>",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("expected %q in message:\n%s", expected, message)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := m.Send(ctx, msg); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected cancelled context error, got %v", err)
+	}
+
+	msg.Template.Body = "missing.html"
+	if _, err := m.Send(context.Background(), msg); err == nil {
+		t.Error("expected missing template error")
+	}
+}
+
+func TestMailer_SendCanceledAfterAccepted(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The context is cancelled once the server accepted the message, which
+	// closes the connection before the reply to QUIT.
+	server := newFakeSMTPServer(t)
+	server.onQuit = cancel
+	m := mailer.NewMailerBuilder("127.0.0.1", server.port(), "golangsp@example.com", "password").
+		WithTLSMode(mailer.TLSModeNone).
+		WithAuthMethod(mailer.AuthNone).
+		Build()
+
+	templateDir := t.TempDir()
+	createTempFile(t, templateDir, "header.html", "<html>")
+	createTempFile(t, templateDir, "footer.html", "</html>")
+	createTempFile(t, filepath.Join(templateDir, "bodies"), "hello.html", "<p>Olá!</p>")
+
+	result, err := m.Send(ctx, mailer.Message{
+		To:       []string{"gopher@example.com"},
+		Subject:  "Confirmação",
+		Template: mailer.TemplateRef{Dir: templateDir, Body: "hello.html"},
+	})
+	if err != nil {
+		t.Fatalf("expected the accepted email to be sent, got %v", err)
+	}
+	if result.Code != 250 || server.messageCount() != 1 {
+		t.Errorf("expected 1 accepted message, got code %d and %d messages", result.Code, server.messageCount())
+	}
+}
+
+func TestMailer_SendFrontMatter(t *testing.T) {
+	server := newFakeSMTPServer(t)
+	m := mailer.NewMailerBuilder("127.0.0.1", server.port(), "golangsp@example.com", "password").
+		WithTLSMode(mailer.TLSModeNone).
+		WithAuthMethod(mailer.AuthNone).
+		Build()
+
+	templateDir := t.TempDir()
+	attachment := createTempFile(t, t.TempDir(), "logo.png", "png")
+	createTempFile(t, templateDir, "header.html", "<html>")
+	createTempFile(t, templateDir, "footer.html", "</html>")
+	createTempFile(t, filepath.Join(templateDir, "bodies"), "hello.html",
+		"---\nsubject: \"Olá, {{.Data.Nome}}\"\nfrom: Golang SP <contato@example.com>\nattachments:\n"+
+			"  - file: "+attachment+"\n    content_type: image/png\n    content_id: logo\n---\n<p>Olá, {{ .Data.Nome }}!</p>")
+
+	_, err := m.Send(context.Background(), mailer.Message{
+		To:       []string{"gopher@example.com"},
+		Template: mailer.TemplateRef{Dir: templateDir, Body: "hello.html"},
+		Data:     map[string]string{"Nome": "Gopher"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to send: %v", err)
+	}
+
+	if server.messageCount() != 1 {
+		t.Fatalf("expected 1 message, got %d", server.messageCount())
+	}
+	message := server.messages[0]
+	for _, expected := range []string{
+		"Subject: Olá, Gopher\n",
+		"From: Golang SP <contato@example.com>\n",
+		"<p>Olá, Gopher!</p>",
+		"Content-ID: <logo>",
+	} {
+		if !strings.Contains(message, expected) {
+			t.Errorf("expected %q in message:\n%s", expected, message)
+		}
+	}
+}
@@ -1,88 +1,449 @@
 package mailer
 
 import (
+	"cmp"
+	"context"
 	"fmt"
 	"html/template"
 	"log/slog"
 	"os"
 	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
+	texttemplate "text/template"
+	"text/template/parse"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/reneepc/gopher-lite-mailer/metrics"
+	"github.com/reneepc/gopher-lite-mailer/tracing"
 )
 
+// EmailTemplate renders the emails of a template directory. With a
+// layout.html, the body is rendered inside the layout: the body defines the
+// blocks it overrides, such as "content" and "head", and a body without
+// defines is used as the "content" block. Without a layout, the output of
+// header.html, the body and footer.html are concatenated. The files in the
+// partials directory and the built-in components can be called from any of
+// them by their name without the extension, e.g. {{template "event-card" .}}.
 type EmailTemplate struct {
+	// TmplHeader and TmplFooter are nil when the directory has a layout, and
+	// TmplBody is then the layout with the blocks of the body.
 	TmplHeader    *template.Template
 	TmplFooter    *template.Template
 	TmplBody      *template.Template
+	name          string
 	css           string
 	signatureLink string
+	frontMatter   FrontMatter
+	subject       *texttemplate.Template
+	inlineCSS     bool
 }
 
 type TemplateData struct {
 	CSS       template.CSS
 	Signature template.URL
+	// Preheader is the rendered preheader, which is also added to the email
+	// as hidden text after the <body> tag.
+	Preheader template.HTML
 	Data      map[string]string
 }
 
+// LayoutFile is the base layout of a template directory.
+const LayoutFile = "layout.html"
+
 func NewEmailTemplate(templateDir, bodyFile, signatureLink string) (EmailTemplate, error) {
-	headerFile := path.Join(templateDir, "header.html")
-	footerFile := path.Join(templateDir, "footer.html")
-	bodyFilePath := path.Join(templateDir, "bodies", bodyFile)
+	return NewEmailTemplateBuilder(templateDir, bodyFile, signatureLink).Build()
+}
+
+// EmailTemplateBuilder creates an EmailTemplate with more options than
+// NewEmailTemplate, such as the locale of the dates and custom functions.
+type EmailTemplateBuilder struct {
+	templateDir   string
+	bodyFile      string
+	signatureLink string
+	locale        string
+	funcs         template.FuncMap
+	strict        bool
+	subject       string
+	preheader     string
+	inlineCSS     bool
+}
+
+func NewEmailTemplateBuilder(templateDir, bodyFile, signatureLink string) EmailTemplateBuilder {
+	return EmailTemplateBuilder{
+		templateDir:   templateDir,
+		bodyFile:      bodyFile,
+		signatureLink: signatureLink,
+		locale:        DefaultLocale,
+		funcs:         make(template.FuncMap),
+	}
+}
+
+// WithLocale sets the language of the month and weekday names written by the
+// date function: en, pt-BR, pt or es.
+func (b EmailTemplateBuilder) WithLocale(locale string) EmailTemplateBuilder {
+	b.locale = locale
+	return b
+}
+
+// WithStrict makes the rendering fail when the template references a field
+// missing from the data, such as {{.Data.Nome}} with a nome column, instead of
+// writing an empty value.
+func (b EmailTemplateBuilder) WithStrict(strict bool) EmailTemplateBuilder {
+	b.strict = strict
+	return b
+}
+
+// WithSubject sets the subject template, replacing the one of the front
+// matter of the body.
+func (b EmailTemplateBuilder) WithSubject(subject string) EmailTemplateBuilder {
+	b.subject = subject
+	return b
+}
+
+// WithPreheader sets the preheader template, replacing the one defined in the
+// body and the one of its front matter.
+func (b EmailTemplateBuilder) WithPreheader(preheader string) EmailTemplateBuilder {
+	b.preheader = preheader
+	return b
+}
+
+// WithInlineCSS moves the CSS rules of the rendered emails into the style
+// attributes of their elements, for the clients that drop <style> blocks.
+func (b EmailTemplateBuilder) WithInlineCSS(inline bool) EmailTemplateBuilder {
+	b.inlineCSS = inline
+	return b
+}
+
+// WithFuncs adds functions to the templates. They replace the built-in
+// functions with the same name.
+func (b EmailTemplateBuilder) WithFuncs(funcs template.FuncMap) EmailTemplateBuilder {
+	merged := make(template.FuncMap, len(b.funcs)+len(funcs))
+	for name, fn := range b.funcs {
+		merged[name] = fn
+	}
+	for name, fn := range funcs {
+		merged[name] = fn
+	}
+	b.funcs = merged
+	return b
+}
+
+func (b EmailTemplateBuilder) Build() (EmailTemplate, error) {
+	if _, ok := locales[b.locale]; !ok {
+		return EmailTemplate{}, fmt.Errorf("unknown locale %q", b.locale)
+	}
+
+	templateDir := b.templateDir
+	funcs := templateFuncs(b.locale, b.funcs)
+	bodyFilePath := path.Join(templateDir, "bodies", b.bodyFile)
 	cssFilePath := path.Join(templateDir, "styles.css")
 
-	tmplHeader, err := template.ParseFiles(headerFile)
-	if err != nil {
-		slog.Error("could not parse header template file: %v", slog.Any("error", err))
-		return EmailTemplate{}, err
+	emailTemplate := EmailTemplate{
+		name:          b.bodyFile,
+		signatureLink: b.signatureLink,
+		inlineCSS:     b.inlineCSS,
 	}
 
-	templateContent, err := template.ParseFiles(bodyFilePath)
+	bodyContent, err := os.ReadFile(bodyFilePath)
 	if err != nil {
-		slog.Error("could not parse template file: %v", slog.Any("error", err))
+		slog.Error("could not parse template file", slog.Any("error", err))
 		return EmailTemplate{}, err
 	}
-
-	tmplFooter, err := template.ParseFiles(footerFile)
+	emailTemplate.frontMatter, bodyContent, err = parseFrontMatter(bodyContent)
 	if err != nil {
-		slog.Error("could not parse footer template file: %v", slog.Any("error", err))
+		err = fmt.Errorf("%s: %v", b.bodyFile, err)
+		slog.Error("could not parse template file", slog.Any("error", err))
 		return EmailTemplate{}, err
 	}
 
+	subject := emailTemplate.frontMatter.Subject
+	if b.subject != "" {
+		subject = b.subject
+	}
+	if subject != "" {
+		emailTemplate.subject, err = texttemplate.New("subject").Funcs(texttemplate.FuncMap(funcs)).Parse(subject)
+		if err != nil {
+			return EmailTemplate{}, fmt.Errorf("could not parse subject: %v", err)
+		}
+	}
+
+	layoutFile := path.Join(templateDir, LayoutFile)
+	if _, err := os.Stat(layoutFile); err == nil {
+		emailTemplate.TmplBody, err = parseLayout(templateDir, layoutFile, b.bodyFile, bodyContent, funcs)
+		if err != nil {
+			slog.Error("could not parse template file", slog.Any("error", err))
+			return EmailTemplate{}, err
+		}
+	} else {
+		headerFile := path.Join(templateDir, "header.html")
+		footerFile := path.Join(templateDir, "footer.html")
+
+		tmplHeader, err := parseFileWithPartials(templateDir, headerFile, funcs)
+		if err != nil {
+			slog.Error("could not parse header template file", slog.Any("error", err))
+			return EmailTemplate{}, err
+		}
+
+		templateContent, err := parseWithPartials(templateDir, b.bodyFile, bodyContent, funcs)
+		if err != nil {
+			slog.Error("could not parse template file", slog.Any("error", err))
+			return EmailTemplate{}, err
+		}
+
+		tmplFooter, err := parseFileWithPartials(templateDir, footerFile, funcs)
+		if err != nil {
+			slog.Error("could not parse footer template file", slog.Any("error", err))
+			return EmailTemplate{}, err
+		}
+
+		emailTemplate.TmplHeader = tmplHeader
+		emailTemplate.TmplBody = templateContent
+		emailTemplate.TmplFooter = tmplFooter
+	}
+
+	// The preheader of the builder replaces the one defined in the body, which
+	// replaces the one of the front matter.
+	if b.preheader != "" || (emailTemplate.TmplBody.Lookup(PreheaderTemplate) == nil && emailTemplate.frontMatter.Preheader != "") {
+		preheader := cmp.Or(b.preheader, emailTemplate.frontMatter.Preheader)
+		if _, err := emailTemplate.TmplBody.New(PreheaderTemplate).Parse(preheader); err != nil {
+			return EmailTemplate{}, fmt.Errorf("could not parse preheader: %v", err)
+		}
+	}
+
+	if b.strict {
+		for _, set := range []*template.Template{emailTemplate.TmplHeader, emailTemplate.TmplBody, emailTemplate.TmplFooter} {
+			if set != nil {
+				set.Option("missingkey=error")
+			}
+		}
+		if emailTemplate.subject != nil {
+			emailTemplate.subject.Option("missingkey=error")
+		}
+	}
+
 	css, err := os.ReadFile(cssFilePath)
 	if err != nil {
-		slog.Warn("could not read CSS file: %v", slog.Any("error", err))
+		slog.Warn("could not read CSS file", slog.Any("error", err))
 	}
+	emailTemplate.css = string(css)
 
-	return EmailTemplate{
-		TmplHeader:    tmplHeader,
-		TmplFooter:    tmplFooter,
-		TmplBody:      templateContent,
-		css:           string(css),
-		signatureLink: signatureLink,
-	}, nil
+	return emailTemplate, nil
+}
+
+// parseLayout parses the layout, the partials and the body into one set,
+// named after the layout, where the body overrides the blocks of the layout.
+func parseLayout(templateDir, layoutFile, bodyName string, body []byte, funcs template.FuncMap) (*template.Template, error) {
+	layout, err := os.ReadFile(layoutFile)
+	if err != nil {
+		return nil, err
+	}
+	set, err := newTemplateSet(LayoutFile, layout, funcs)
+	if err != nil {
+		return nil, err
+	}
+	if err := parsePartials(set, templateDir); err != nil {
+		return nil, err
+	}
+
+	var layoutContent *parse.Tree
+	if content := set.Lookup("content"); content != nil {
+		layoutContent = content.Tree
+	}
+
+	bodyTemplate, err := set.New(bodyName).Parse(string(body))
+	if err != nil {
+		return nil, err
+	}
+
+	// A body that does not define the content block is the content itself.
+	if content := set.Lookup("content"); content == nil || content.Tree == layoutContent {
+		if _, err := set.AddParseTree("content", bodyTemplate.Tree.Copy()); err != nil {
+			return nil, err
+		}
+	}
+	return set, nil
+}
+
+// parseFileWithPartials parses the file along with the partials of the
+// template directory.
+func parseFileWithPartials(templateDir, file string, funcs template.FuncMap) (*template.Template, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseWithPartials(templateDir, filepath.Base(file), content, funcs)
+}
+
+// parseWithPartials parses the content into a set with the name, along with
+// the partials of the template directory.
+func parseWithPartials(templateDir, name string, content []byte, funcs template.FuncMap) (*template.Template, error) {
+	tmpl, err := newTemplateSet(name, content, funcs)
+	if err != nil {
+		return nil, err
+	}
+	if err := parsePartials(tmpl, templateDir); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// parsePartials adds every file of the partials directory to the set, also
+// under its name without the extension unless the file defines it itself. A
+// missing directory has no partials.
+func parsePartials(set *template.Template, templateDir string) error {
+	files, err := filepath.Glob(filepath.Join(templateDir, "partials", "*.html"))
+	if err != nil || len(files) == 0 {
+		return err
+	}
+
+	for _, file := range files {
+		name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+		defined := set.Lookup(name)
+
+		if _, err := set.ParseFiles(file); err != nil {
+			return fmt.Errorf("could not parse partial %s: %v", name, err)
+		}
+		if set.Lookup(name) == defined {
+			partial := set.Lookup(filepath.Base(file))
+			if _, err := set.AddParseTree(name, partial.Tree.Copy()); err != nil {
+				return fmt.Errorf("could not add partial %s: %v", name, err)
+			}
+		}
+	}
+	return nil
 }
 
 func (t *EmailTemplate) Execute(data map[string]string) (string, error) {
+	return t.ExecuteContext(context.Background(), data)
+}
+
+// ExecuteContext is like Execute, tracing the rendering as a child of the
+// span in the context.
+func (t *EmailTemplate) ExecuteContext(ctx context.Context, data map[string]string) (body string, err error) {
+	_, span := tracing.Tracer().Start(ctx, "render", trace.WithAttributes(attribute.String("template", t.name)))
+	start := time.Now()
+	defer func() {
+		metrics.RenderDuration.WithLabelValues(t.name).Observe(time.Since(start).Seconds())
+		tracing.End(span, err)
+	}()
+
+	for _, field := range t.frontMatter.Required {
+		if strings.TrimSpace(data[field]) == "" {
+			return "", fmt.Errorf("required field %s is empty", field)
+		}
+	}
+
 	templateData := TemplateData{
 		CSS:       template.CSS(t.css),
 		Signature: template.URL(t.signatureLink),
 		Data:      data,
 	}
-	var body strings.Builder
+	if preheader := t.TmplBody.Lookup(PreheaderTemplate); preheader != nil {
+		var b strings.Builder
+		if err := preheader.Execute(&b, templateData); err != nil {
+			return "", fmt.Errorf("could not execute preheader template: %v", err)
+		}
+		templateData.Preheader = template.HTML(strings.TrimSpace(b.String()))
+	}
+	var b strings.Builder
 
-	err := t.TmplHeader.Execute(&body, templateData)
-	if err != nil {
-		return "", fmt.Errorf("could not execute header template: %v", err)
+	if t.TmplHeader != nil {
+		err = t.TmplHeader.Execute(&b, templateData)
+		if err != nil {
+			return "", fmt.Errorf("could not execute header template: %v", err)
+		}
 	}
 
-	err = t.TmplBody.Execute(&body, templateData)
+	err = t.TmplBody.Execute(&b, templateData)
 	if err != nil {
 		return "", fmt.Errorf("could not execute template: %v", err)
 	}
 
-	err = t.TmplFooter.Execute(&body, templateData)
+	if t.TmplFooter != nil {
+		err = t.TmplFooter.Execute(&b, templateData)
+		if err != nil {
+			return "", fmt.Errorf("could not execute footer template: %v", err)
+		}
+	}
+
+	result := injectPreheader(b.String(), templateData.Preheader)
+	if t.inlineCSS {
+		return inlineCSS(result)
+	}
+	return result, nil
+}
+
+// PreheaderTemplate is the name of the template a body defines to set its
+// preheader, the summary shown by the email clients after the subject:
+//
+//	{{define "preheader"}}Traga seu notebook, {{.Data.Nome}}!{{end}}
+const PreheaderTemplate = "preheader"
+
+var bodyTag = regexp.MustCompile(`(?i)<body(\s[^>]*)?>`)
+
+// injectPreheader adds the preheader as hidden text right after the <body>
+// tag, or at the start of an email without one, so the clients show it in
+// the inbox instead of the first visible line. The padding that follows keeps
+// them from filling the rest of the preview with the text of the email.
+func injectPreheader(html string, preheader template.HTML) string {
+	if preheader == "" {
+		return html
+	}
+
+	hidden := `<span class="preheader" style="display: none !important; visibility: hidden; mso-hide: all; ` +
+		`font-size: 1px; line-height: 1px; max-height: 0; max-width: 0; opacity: 0; overflow: hidden; color: transparent;">` +
+		string(preheader) + strings.Repeat("&#847;&zwnj;&nbsp;", 30) + `</span>`
+
+	position := 0
+	if match := bodyTag.FindStringIndex(html); match != nil {
+		position = match[1]
+	}
+	return html[:position] + hidden + html[position:]
+}
+
+// FrontMatter returns the front matter of the body, which is empty when the
+// body has none.
+func (t EmailTemplate) FrontMatter() FrontMatter {
+	return t.frontMatter
+}
+
+// Subject renders the subject with the data. It is empty when neither the
+// builder nor the front matter of the body set one.
+func (t *EmailTemplate) Subject(data map[string]string) (string, error) {
+	if t.subject == nil {
+		return "", nil
+	}
+
+	var b strings.Builder
+	if err := t.subject.Execute(&b, TemplateData{Data: data}); err != nil {
+		return "", fmt.Errorf("could not execute subject template: %v", err)
+	}
+	// Line breaks in the data would end the Subject header.
+	return strings.Join(strings.Fields(b.String()), " "), nil
+}
+
+// Render renders the subject and the body of the email with the data, along
+// with the sender and attachments of the front matter of the body.
+func (t *EmailTemplate) Render(ctx context.Context, data map[string]string) (Email, error) {
+	subject, err := t.Subject(data)
+	if err != nil {
+		return Email{}, err
+	}
+
+	body, err := t.ExecuteContext(ctx, data)
 	if err != nil {
-		return "", fmt.Errorf("could not execute footer template: %v", err)
+		return Email{}, err
 	}
 
-	return body.String(), nil
+	return Email{
+		Subject:     subject,
+		Body:        body,
+		From:        t.frontMatter.From,
+		Attachments: t.frontMatter.Attachments,
+	}, nil
 }
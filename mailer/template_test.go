@@ -3,6 +3,7 @@ package mailer_test
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/reneepc/gopher-lite-mailer/mailer"
@@ -199,3 +200,201 @@ func TestEmailTemplate_Execute(t *testing.T) {
 		})
 	}
 }
+
+func TestEmailTemplate_ExecuteLayout(t *testing.T) {
+	layoutContent := `<html><head>{{block "head" .}}{{end}}</head><body>{{block "content" .}}Empty{{end}}` +
+		`{{block "footer" .}}<footer>{{template "signature" .}}</footer>{{end}}</body></html>`
+	signatureContent := `<img src="{{.Signature}}">`
+
+	tests := map[string]struct {
+		body     string
+		expected string
+	}{
+		"Body Without Blocks": {
+			body:     "<p>Hello, {{.Data.Name}}!</p>",
+			expected: `<html><head></head><body><p>Hello, Renê Cardozo!</p><footer><img src="http://golang.samba.br"></footer></body></html>`,
+		},
+		"Body Overriding Blocks": {
+			body: `{{define "head"}}<title>Hi</title>{{end}}{{define "content"}}<p>Hello, {{.Data.Name}}!</p>{{end}}` +
+				`{{define "footer"}}<footer>Bye</footer>{{end}}`,
+			expected: `<html><head><title>Hi</title></head><body><p>Hello, Renê Cardozo!</p><footer>Bye</footer></body></html>`,
+		},
+		"Body Calling A Partial": {
+			body:     `<p>{{.Data.Name}}</p>{{template "signature" .}}`,
+			expected: `<html><head></head><body><p>Renê Cardozo</p><img src="http://golang.samba.br"><footer><img src="http://golang.samba.br"></footer></body></html>`,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "layout.html", layoutContent)
+			createTempFile(t, filepath.Join(tmpDir, "partials"), "signature.html", signatureContent)
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+
+			emailTemplate, err := mailer.NewEmailTemplate(tmpDir, "body1.html", "http://golang.samba.br")
+			if err != nil {
+				t.Fatalf("Failed to create EmailTemplate: %v", err)
+			}
+
+			result, err := emailTemplate.Execute(map[string]string{"Name": "Renê Cardozo"})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Execute() result = %v, expected %v", result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestEmailTemplate_ExecuteComponents(t *testing.T) {
+	tests := map[string]struct {
+		body        string
+		partial     string
+		contains    []string
+		expectError bool
+	}{
+		"Button": {
+			body:     `{{template "button" (dict "Text" "Inscreva-se" "URL" "https://golang.sampa.br")}}`,
+			contains: []string{`role="presentation"`, `bgcolor="#00ADD8"`, `href="https://golang.sampa.br"`, ">Inscreva-se</a>"},
+		},
+		"Button With Color": {
+			body:     `{{template "button" (dict "Text" "Go" "URL" "https://go.dev" "Color" "#FA5252")}}`,
+			contains: []string{`bgcolor="#FA5252"`},
+		},
+		"Callout": {
+			body:     `{{template "callout" (dict "Title" "Importante" "Text" .Data.Name)}}`,
+			contains: []string{"<strong>Importante</strong><br>", "Renê Cardozo"},
+		},
+		"Key Value Table Keeps The Order": {
+			body:     `{{template "key-value-table" (pairs "Horário" "19:00" "Local" "São Paulo")}}`,
+			contains: []string{"Horário</td>", "19:00</td>", "Local</td>", "São Paulo</td>"},
+		},
+		"Partial Replacing A Component": {
+			body:     `{{template "button" (dict "Text" "Go")}}`,
+			partial:  `<b>{{index . "Text"}}</b>`,
+			contains: []string{"<b>Go</b>"},
+		},
+		"Odd Dict Arguments": {
+			body:        `{{template "button" (dict "Text")}}`,
+			expectError: true,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "header.html", "")
+			createTempFile(t, tmpDir, "footer.html", "")
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+			if tt.partial != "" {
+				createTempFile(t, filepath.Join(tmpDir, "partials"), "button.html", tt.partial)
+			}
+
+			emailTemplate, err := mailer.NewEmailTemplate(tmpDir, "body1.html", "http://golang.samba.br")
+			if err != nil {
+				t.Fatalf("Failed to create EmailTemplate: %v", err)
+			}
+
+			result, err := emailTemplate.Execute(map[string]string{"Name": "Renê Cardozo"})
+			if (err != nil) != tt.expectError {
+				t.Fatalf("Execute() error = %v, expectError %v", err, tt.expectError)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(result, want) {
+					t.Errorf("Execute() result = %v, expected it to contain %v", result, want)
+				}
+			}
+		})
+	}
+}
+
+func TestEmailTemplate_ExecutePreheader(t *testing.T) {
+	const hidden = `<span class="preheader" style="display: none !important;`
+
+	tests := map[string]struct {
+		header    string
+		body      string
+		preheader string
+		name      string
+		contains  []string
+		prefix    string
+		excludes  []string
+	}{
+		"From Front Matter": {
+			header:   `<html><body class="main">`,
+			body:     "---\npreheader: Olá, {{.Data.Name}}\n---\n<p>{{.Preheader}}</p>",
+			prefix:   `<html><body class="main">` + hidden,
+			contains: []string{`color: transparent;">Olá, Renê Cardozo&#847;`, "<p>Olá, Renê Cardozo</p>"},
+		},
+		"Defined In The Body": {
+			header:   `<html><BODY>`,
+			body:     "---\npreheader: Front matter\n---\n{{define \"preheader\"}} Traga seu notebook {{end}}<p>Hi</p>",
+			prefix:   `<html><BODY>` + hidden,
+			contains: []string{`color: transparent;">Traga seu notebook&#847;`},
+			excludes: []string{"Front matter"},
+		},
+		"From The Builder": {
+			header:    `<html><body>`,
+			body:      "{{define \"preheader\"}}Body{{end}}<p>Hi</p>",
+			preheader: "Builder {{.Data.Name}}",
+			contains:  []string{`color: transparent;">Builder Renê Cardozo&#847;`},
+			excludes:  []string{"Body"},
+		},
+		"Without A Body Tag": {
+			body:     "---\npreheader: Hi\n---\n<p>Hi</p>",
+			prefix:   hidden,
+			contains: []string{"</span><p>Hi</p>"},
+		},
+		"Escaped": {
+			header:   `<body>`,
+			body:     "---\npreheader: \"{{.Data.Name}}\"\n---\n<p>Hi</p>",
+			name:     "<b>",
+			contains: []string{`color: transparent;">&lt;b&gt;&#847;`},
+		},
+		"Without A Preheader": {
+			header:   `<body>`,
+			body:     "<p>Hi</p>",
+			excludes: []string{hidden},
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+			createTempFile(t, tmpDir, "header.html", tt.header)
+			createTempFile(t, tmpDir, "footer.html", "")
+			createTempFile(t, filepath.Join(tmpDir, "bodies"), "body1.html", tt.body)
+
+			emailTemplate, err := mailer.NewEmailTemplateBuilder(tmpDir, "body1.html", "http://golang.samba.br").
+				WithPreheader(tt.preheader).
+				Build()
+			if err != nil {
+				t.Fatalf("Failed to create EmailTemplate: %v", err)
+			}
+
+			name := tt.name
+			if name == "" {
+				name = "Renê Cardozo"
+			}
+			result, err := emailTemplate.Execute(map[string]string{"Name": name})
+			if err != nil {
+				t.Fatalf("Execute() error = %v", err)
+			}
+			if !strings.HasPrefix(result, tt.prefix) {
+				t.Errorf("Execute() result = %v, expected it to start with %v", result, tt.prefix)
+			}
+			for _, want := range tt.contains {
+				if !strings.Contains(result, want) {
+					t.Errorf("Execute() result = %v, expected it to contain %v", result, want)
+				}
+			}
+			for _, unwanted := range tt.excludes {
+				if strings.Contains(result, unwanted) {
+					t.Errorf("Execute() result = %v, expected it not to contain %v", result, unwanted)
+				}
+			}
+		})
+	}
+}
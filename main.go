@@ -2,86 +2,346 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log/slog"
 	"os"
-	"path"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+	// Embeds the timezone database, so schedules work on systems without one.
+	_ "time/tzdata"
 
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/reneepc/gopher-lite-mailer/campaign"
+	"github.com/reneepc/gopher-lite-mailer/logging"
 	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/metrics"
 	"github.com/reneepc/gopher-lite-mailer/parser"
-	"golang.org/x/time/rate"
+	"github.com/reneepc/gopher-lite-mailer/progress"
+	"github.com/reneepc/gopher-lite-mailer/report"
+	"github.com/reneepc/gopher-lite-mailer/schedule"
+	"github.com/reneepc/gopher-lite-mailer/tracing"
+	"github.com/reneepc/gopher-lite-mailer/webhook"
 )
 
+type command struct {
+	name        string
+	description string
+	run         func(args []string) error
+}
+
+var commands = []command{
+	{"send", "Send the campaign to every recipient in the data file", runSend},
+	{"validate", "Check the templates and data of a campaign without sending anything", runValidate},
+	{"list", "List the available template directories and bodies", runList},
+	{"preview", "Render the email of a single recipient", runPreview},
+	{"test", "Send the email of the first recipient to a single address", runTest},
+	{"quota", "Show the daily quota usage of each sender account", runQuota},
+	{"daemon", "Send the jobs written to a spool directory by other programs", runDaemon},
+	{"api", "Serve JSON endpoints to send emails and campaigns", runAPI},
+	{"retry-failed", "Send the campaign again to the recipients that failed in a report", runRetryFailed},
+	{"webhook-receiver", "Print the webhook events posted to it, to develop and test webhooks", runWebhookReceiver},
+}
+
 func main() {
-	templateSubDir := flag.String("dir", "standard", "Subdirectory containing the template files")
-	bodyFile := flag.String("body", "workshop-confirmation.html", "Body template file to use")
-	dataFile := flag.String("data", "data.csv", "Data file to use (should be in the data subdirectory of the template directory)")
-	signatureLink := flag.String("signature", "https://golang.sampa.br/img/golangsp01.png", "Signature link to use for the email body")
-	subject := flag.String("subject", "", "Subject of the email")
-
-	flag.Parse()
-
-	if len(flag.Args()) < 2 {
-		slog.Error("email and password are required")
-		slog.Error("Usage: gopher-lite-mailer [options] <email> <password>")
-		slog.Error("Options:")
-		flag.PrintDefaults()
+	logging.SetOutput(os.Stderr)
+
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(2)
+	}
+
+	name := os.Args[1]
+	if name == "help" || name == "-h" || name == "-help" || name == "--help" {
+		if len(os.Args) > 2 {
+			name = os.Args[2]
+			if cmd, ok := findCommand(name); ok {
+				cmd.run([]string{"-h"})
+			}
+		}
+		usage()
+		return
+	}
+
+	cmd, ok := findCommand(name)
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+		usage()
+		os.Exit(2)
+	}
+
+	if err := cmd.run(os.Args[2:]); err != nil {
+		slog.Error(fmt.Sprintf("%s failed", cmd.name), slog.Any("error", err))
 		os.Exit(1)
 	}
+}
 
-	args := flag.Args()
-	email, password := args[0], args[1]
+func findCommand(name string) (command, bool) {
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd, true
+		}
+	}
+	return command{}, false
+}
 
-	templateDir := path.Join("templates", *templateSubDir)
-	templateContent, err := mailer.NewEmailTemplate(templateDir, *bodyFile, *signatureLink)
+func usage() {
+	fmt.Fprintln(os.Stderr, "Usage: gopher-lite-mailer <command> [options] [arguments]")
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(os.Stderr, "  %-10s %s\n", cmd.name, cmd.description)
+	}
+	fmt.Fprintln(os.Stderr)
+	fmt.Fprintln(os.Stderr, "Run \"gopher-lite-mailer help <command>\" for the options of a command.")
+}
+
+// newFlagSet creates the flag set of a command, with a help text made of its
+// arguments and description followed by its options.
+func newFlagSet(name, arguments, description string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	fs.Func("log-format", "Format of the log lines: text (default) or json", logging.SetFormat)
+	fs.Func("log-level", "Minimum level of the log lines: debug, info (default), warn or error", logging.SetLevel)
+	fs.Func("log-emails", "How recipient addresses are logged: plain (default), mask or hash, for logs shared publicly", logging.SetEmails)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), strings.TrimSpace(fmt.Sprintf("Usage: gopher-lite-mailer %s [options] %s", name, arguments)))
+		fmt.Fprintln(fs.Output())
+		fmt.Fprintf(fs.Output(), "%s\n\n", description)
+		fmt.Fprintln(fs.Output(), "Options:")
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+func runSend(args []string) error {
+	fs := newFlagSet("send", "[email]",
+		"Sends the campaign to every recipient in the data file.")
+	opts := newCampaignOptions(fs)
+	sender := newSenderOptions(fs)
+	waitForQuota := fs.Bool("wait-for-quota", false, "Pause until the daily quota frees up instead of stopping when every account reached it")
+	reportFile := fs.String("report", "", "File to write the outcome of every recipient to, as CSV or JSON according to its extension")
+	telemetry := newTelemetryOptions(fs)
+	fs.Parse(args)
+
+	c, err := opts.campaign()
 	if err != nil {
-		slog.Error("could not create email template: %v", slog.Any("error", err))
-		return
+		return err
 	}
 
-	dataFilePath := path.Join(templateDir, "data", *dataFile)
-	mailContent, err := parser.ParseRecords(dataFilePath)
+	stopTelemetry, err := telemetry.start(context.Background())
 	if err != nil {
-		slog.Error("could not parse CSV file: %v", slog.Any("error", err))
-		return
+		return err
+	}
+	defer stopTelemetry()
+
+	mailContent, err := loadRecords(c)
+	if err != nil {
+		return err
+	}
+
+	startedAt := time.Now()
+	results, err := sendCampaign(context.Background(), c, sender, fs.Args(), mailContent, *waitForQuota)
+	if err != nil {
+		return err
+	}
+
+	if *reportFile != "" {
+		if err := report.New(c.Key(), startedAt, results).Write(*reportFile); err != nil {
+			return err
+		}
+		slog.Info("📝 Report written", slog.String("report", *reportFile))
+	}
+	return nil
+}
+
+// sendCampaign sends the campaign to the given records, following its
+// schedule, and logs a summary per sender account.
+func sendCampaign(ctx context.Context, c campaign.Campaign, sender *senderOptions, args []string, records []parser.MailRecord, waitForQuota bool) ([]mailer.RecordResult, error) {
+	pool, rateLimit, err := sender.pool(c, args)
+	if err != nil {
+		return nil, err
+	}
+
+	templateContent, err := loadTemplate(c)
+	if err != nil {
+		return nil, err
+	}
+	if c.Strict {
+		if err := templateContent.CheckFields(parser.Fields(records)); err != nil {
+			return nil, err
+		}
 	}
 
-	emailMailer := mailer.NewGMailMailerBuilder(email, password).Build()
+	sched, state, err := sender.schedule(c)
+	if err != nil {
+		return nil, err
+	}
 
-	sendEmails(emailMailer, *subject, templateContent, mailContent)
+	if saved, _ := state.Get(c.Key()); len(saved.Sent) > 0 {
+		records = unsentRecords(records, saved.Sent)
+		slog.Info("⏭️ Skipping recipients sent by a previous run of the campaign",
+			slog.String(logging.KeyCampaign, c.Key()), slog.Int("count", len(saved.Sent)), slog.Int("remaining", len(records)))
+	}
+
+	if remaining := pool.Remaining(); remaining >= 0 && remaining < len(records) {
+		slog.Warn("⚠️ Daily quota is not enough for every recipient",
+			slog.Int("recipients", len(records)), slog.Int("remaining_quota", remaining))
+	}
+
+	notifier, err := webhookNotifier(c)
+	if err != nil {
+		return nil, err
+	}
+	defer notifier.Close()
+
+	ctx, span := tracing.Tracer().Start(ctx, "campaign", trace.WithAttributes(
+		attribute.String("campaign", c.Key()),
+		attribute.Int("recipients", len(records)),
+	))
+	results := sendEmails(ctx, pool, c.Subject, templateContent, records, sendOptions{
+		campaign:     c.Key(),
+		monitor:      webhook.NewMonitor(notifier, c.Key(), c.ErrorRate.Threshold, c.ErrorRate.MinEmails),
+		rateLimit:    rateLimit,
+		schedule:     sched,
+		state:        state,
+		waitForQuota: waitForQuota,
+	})
+	span.End()
+
+	// The state is kept until every recipient was sent to or failed, so a run
+	// stopped by the quota resumes without sending to anyone twice.
+	if slices.ContainsFunc(results, func(r mailer.RecordResult) bool { return r.Status == mailer.StatusSkipped }) {
+		slog.Info("💾 Campaign not finished, running it again sends to the remaining recipients", slog.String(logging.KeyCampaign, c.Key()))
+	} else if err := state.Delete(c.Key()); err != nil {
+		slog.Warn("could not clear saved schedule", slog.Any("error", err))
+	}
+
+	for _, account := range pool.Accounts() {
+		if account.Disabled != nil {
+			slog.Warn("📊 Account summary", slog.String(logging.KeyAccount, account.Name), slog.Int("sent", account.Sent), slog.Any("disabled", account.Disabled))
+		} else {
+			slog.Info("📊 Account summary", slog.String(logging.KeyAccount, account.Name), slog.Int("sent", account.Sent))
+		}
+	}
+	return results, nil
 }
 
-func sendEmails(mailer mailer.Mailer, subject string, template mailer.EmailTemplate, records []parser.MailRecord) {
-	var wg sync.WaitGroup
-	limiter := rate.NewLimiter(rate.Every(2*time.Second), 5)
+// unsentRecords returns the records whose recipients are not in sent.
+func unsentRecords(records []parser.MailRecord, sent []string) []parser.MailRecord {
+	var unsent []parser.MailRecord
+	for _, record := range records {
+		if !slices.Contains(sent, record.Email) {
+			unsent = append(unsent, record)
+		}
+	}
+	return unsent
+}
 
-	for _, mailRecord := range records {
-		wg.Add(1)
-		go func(record parser.MailRecord) {
-			defer wg.Done()
+type sendOptions struct {
+	campaign     string
+	monitor      *webhook.Monitor
+	rateLimit    campaign.RateLimit
+	schedule     schedule.Schedule
+	state        *schedule.State
+	waitForQuota bool
+}
 
-			err := limiter.Wait(context.Background())
-			if err != nil {
-				slog.Error("could not wait for rate limiter: %v", slog.Any("error", err))
-				return
-			}
+// progressInterval is how often the progress is logged when the output is not
+// a terminal.
+const progressInterval = 30 * time.Second
+
+// sendEmails sends the emails of every record, logging each outcome, and
+// returns their results.
+func sendEmails(ctx context.Context, pool *mailer.Pool, subject string, template mailer.EmailTemplate, records []parser.MailRecord, opts sendOptions) []mailer.RecordResult {
+	logger := slog.With(slog.String(logging.KeyCampaign, opts.campaign))
+	limiter := newLimiter(opts.rateLimit)
 
-			body, err := template.Execute(record.Data)
+	var pauseMu sync.Mutex
+	var pausedUntil time.Time
+	onPause := func(resumeAt time.Time) {
+		pauseMu.Lock()
+		defer pauseMu.Unlock()
+		if !resumeAt.Equal(pausedUntil) {
+			pausedUntil = resumeAt
+			logger.Info("⏰ Outside of the sending schedule, waiting", slog.Time("resume_at", resumeAt))
+		}
+	}
+
+	// The schedule is checked again after the rate limiter, since the window
+	// may close while waiting for it.
+	wait := func(ctx context.Context, record parser.MailRecord) error {
+		recipientSchedule := opts.schedule.For(record.Timezone)
+		for {
+			if err := recipientSchedule.Wait(ctx, onPause); err != nil {
+				return err
+			}
+			_, span := tracing.Tracer().Start(ctx, "rate limit")
+			err := metrics.WaitRateLimit(ctx, limiter)
+			span.End()
 			if err != nil {
-				slog.Error("could not execute template: %v", slog.Any("error", err))
-				return
+				return fmt.Errorf("could not wait for rate limiter: %v", err)
+			}
+			if recipientSchedule.Allowed(time.Now()) {
+				return nil
 			}
+		}
+	}
 
-			err = mailer.SendMail(record.Email, subject, body)
-			if err != nil {
-				slog.Error("❌ Could not send email", slog.String("email", record.Email), slog.Any("error", err))
-			} else {
-				slog.Info("✅ Email successfully sent", slog.String("email", record.Email))
+	opts.monitor.Start(len(records))
+
+	// Every record waits for its own schedule, so none of them holds back the
+	// recipients in other timezones.
+	results := pool.SendBatch(ctx, template, records, mailer.BatchOptions{
+		Subject:      subject,
+		Concurrency:  len(records),
+		Wait:         wait,
+		WaitForQuota: opts.waitForQuota,
+	})
+
+	// Log lines go through the progress, so they are written above its status
+	// line on a terminal.
+	view := progress.New(os.Stderr, len(records), progressInterval)
+	logging.SetOutput(view)
+	defer logging.SetOutput(os.Stderr)
+	view.Start()
+	defer view.Stop()
+
+	defer opts.monitor.Finish()
+
+	var collected []mailer.RecordResult
+	unsent := 0
+	for result := range results {
+		collected = append(collected, result)
+		view.Record(result)
+		opts.monitor.Record(result)
+
+		var quotaErr *mailer.QuotaError
+		switch {
+		case result.Status == mailer.StatusSent:
+			logger.Info("✅ Email successfully sent", slog.String(logging.KeyRecipient, result.Record.Email), slog.String(logging.KeyAccount, result.Account),
+				slog.String(logging.KeyMessageID, result.MessageID), slog.Int(logging.KeySMTPCode, result.Code))
+			if err := opts.state.MarkSent(opts.campaign, result.Record.Email); err != nil {
+				logger.Warn("could not save sent recipient, it will be sent again if the campaign is resumed", slog.String(logging.KeyRecipient, result.Record.Email), slog.Any("error", err))
 			}
-		}(mailRecord)
+		case errors.As(result.Err, &quotaErr):
+			if unsent == 0 {
+				logger.Error("⛔ Daily quota reached by every sender account, stopping. Run again later or use -wait-for-quota",
+					slog.Time("retry_at", quotaErr.RetryAt))
+			}
+			unsent++
+		default:
+			logger.Error("❌ Could not send email", slog.String(logging.KeyRecipient, result.Record.Email), slog.String(logging.KeyAccount, result.Account),
+				slog.Int(logging.KeySMTPCode, result.Code), slog.Any("error", result.Err))
+		}
 	}
 
-	wg.Wait()
+	if unsent > 0 {
+		logger.Warn("📭 Emails not sent because of the daily quota", slog.Int("count", unsent))
+	}
+	return collected
 }
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
+)
+
+const namespace = "gopher_lite_mailer"
+
+// Registry holds the metrics of the mailer, along with the Go runtime and
+// process ones.
+var Registry = prometheus.NewRegistry()
+
+var (
+	// MessagesSent counts the emails accepted by the server per sender
+	// account.
+	MessagesSent = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_sent_total",
+		Help:      "Emails accepted by the SMTP server.",
+	}, []string{"account"})
+
+	// MessagesFailed counts the emails that could not be sent per sender
+	// account and reason: auth, quota, rejected for 5xx replies, temporary
+	// for 4xx replies, network, canceled or other.
+	MessagesFailed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "messages_failed_total",
+		Help:      "Emails that could not be sent, by reason.",
+	}, []string{"account", "reason"})
+
+	// SMTPDuration observes how long each phase of an SMTP session takes:
+	// connect, starttls, auth, envelope, data and quit.
+	SMTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "smtp_phase_duration_seconds",
+		Help:      "Duration of each phase of the SMTP session.",
+		Buckets:   []float64{.01, .05, .1, .25, .5, 1, 2.5, 5, 10, 30},
+	}, []string{"phase"})
+
+	// RateLimitWait observes how long each email waited for the rate limiter.
+	RateLimitWait = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_wait_seconds",
+		Help:      "Time each email waited for the rate limiter.",
+		Buckets:   []float64{.01, .1, .5, 1, 2, 5, 10, 30, 60},
+	})
+
+	// QueueDepth is the number of emails waiting to be sent.
+	QueueDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "queue_depth",
+		Help:      "Emails waiting to be sent.",
+	})
+
+	// RenderDuration observes how long rendering each email takes per body
+	// template.
+	RenderDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "template_render_duration_seconds",
+		Help:      "Duration of the rendering of an email.",
+		Buckets:   []float64{.0001, .0005, .001, .005, .01, .05, .1, .5},
+	}, []string{"template"})
+)
+
+func init() {
+	Registry.MustRegister(
+		MessagesSent,
+		MessagesFailed,
+		SMTPDuration,
+		RateLimitWait,
+		QueueDepth,
+		RenderDuration,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+// WaitRateLimit waits for the limiter like rate.Limiter.Wait, observing the
+// wait in RateLimitWait.
+func WaitRateLimit(ctx context.Context, limiter *rate.Limiter) error {
+	start := time.Now()
+	err := limiter.Wait(ctx)
+	RateLimitWait.Observe(time.Since(start).Seconds())
+	return err
+}
+
+// Serve exposes the metrics on /metrics at addr until the context is done.
+// It returns once the listener is open, so the address can be used right away.
+func Serve(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("could not listen for metrics: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(Registry, promhttp.HandlerOpts{}))
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+	context.AfterFunc(ctx, func() { server.Close() })
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			slog.Error("metrics server stopped", slog.Any("error", err))
+		}
+	}()
+
+	slog.Info("📈 Serving metrics on /metrics", slog.String("addr", listener.Addr().String()))
+	return nil
+}
@@ -0,0 +1,477 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/campaign"
+	"github.com/reneepc/gopher-lite-mailer/credentials"
+	"github.com/reneepc/gopher-lite-mailer/logging"
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/metrics"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+	"github.com/reneepc/gopher-lite-mailer/profile"
+	"github.com/reneepc/gopher-lite-mailer/quota"
+	"github.com/reneepc/gopher-lite-mailer/schedule"
+	"github.com/reneepc/gopher-lite-mailer/tracing"
+	"github.com/reneepc/gopher-lite-mailer/webhook"
+)
+
+const templatesRoot = "templates"
+
+// campaignOptions holds the flags shared by every command that works on a
+// campaign. Flags given on the command line override the campaign file.
+type campaignOptions struct {
+	flags         *flag.FlagSet
+	campaignFile  *string
+	templateDir   *string
+	bodyFile      *string
+	dataFile      *string
+	signatureLink *string
+	locale        *string
+	strict        *bool
+	inlineCSS     *bool
+	subject       *string
+	preheader     *string
+	provider      *string
+	profile       *string
+	rateInterval  *time.Duration
+	rateBurst     *int
+	sendAt        *string
+	window        *string
+	timezone      *string
+	headers       stringList
+	attachments   stringList
+	webhooks      stringList
+	webhookSecret *string
+}
+
+func newCampaignOptions(fs *flag.FlagSet) *campaignOptions {
+	defaults := campaign.Default()
+
+	o := &campaignOptions{
+		flags:         fs,
+		campaignFile:  fs.String("campaign", "", "Campaign definition file (YAML). Flags override its fields"),
+		templateDir:   fs.String("dir", defaults.Dir, "Subdirectory containing the template files"),
+		bodyFile:      fs.String("body", defaults.Body, "Body template file to use"),
+		dataFile:      fs.String("data", defaults.Data, "Data file to use (should be in the data subdirectory of the template directory)"),
+		signatureLink: fs.String("signature", defaults.Signature, "Signature link to use for the email body"),
+		locale:        fs.String("locale", defaults.Locale, "Language of the dates written by the templates: en, pt-BR or es (defaults to pt-BR)"),
+		strict:        fs.Bool("strict", defaults.Strict, "Fail when the template references a field missing from the data file instead of rendering it empty"),
+		inlineCSS:     fs.Bool("inline-css", defaults.InlineCSS, "Move the CSS rules into the style attributes of the elements, for the clients that drop <style> blocks"),
+		subject:       fs.String("subject", defaults.Subject, "Subject of the email"),
+		preheader:     fs.String("preheader", defaults.Preheader, "Preview text shown by the email clients after the subject, replacing the one of the body"),
+		provider:      fs.String("provider", defaults.Sender.Provider, "Email provider to send from (gmail or outlook)"),
+		profile:       fs.String("profile", defaults.Sender.Profile, "Sender profiles to send from, as defined in the profiles file. Separate several profiles with commas to distribute the emails across them"),
+		rateInterval:  fs.Duration("rate-interval", defaults.RateLimit.Interval, "Minimum interval between emails"),
+		rateBurst:     fs.Int("rate-burst", defaults.RateLimit.Burst, "Number of emails that can be sent at once before the interval applies"),
+		sendAt:        fs.String("send-at", "", "Time to start sending, in RFC 3339 format (e.g. 2024-08-06T08:00:00-03:00) or as a wall clock time in -timezone (e.g. \"2024-08-06 08:00\")"),
+		window:        fs.String("window", "", "Daily period in which emails may be sent, e.g. 08:00-21:00. Sending pauses outside of it"),
+		timezone:      fs.String("timezone", "", "Timezone of -send-at and -window, e.g. America/Sao_Paulo (defaults to the local one)"),
+	}
+	fs.Var(&o.headers, "header", "Custom header in the \"Key: Value\" format (can be repeated)")
+	fs.Var(&o.attachments, "attach", "File to attach to the email (can be repeated)")
+	fs.Var(&o.webhooks, "webhook", "URL to post the campaign events to (can be repeated)")
+	o.webhookSecret = fs.String("webhook-secret-source", "", "Where to read the key the -webhook requests are signed with, in the format of -password-source (unsigned by default)")
+
+	return o
+}
+
+// campaign loads the campaign file, if any, and applies the flags that were
+// set on the command line on top of it.
+func (o *campaignOptions) campaign() (campaign.Campaign, error) {
+	c := campaign.Default()
+	if *o.campaignFile != "" {
+		var err error
+		c, err = campaign.Load(*o.campaignFile)
+		if err != nil {
+			return campaign.Campaign{}, err
+		}
+	}
+
+	var flagErr error
+	o.flags.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "dir":
+			c.Dir = *o.templateDir
+		case "body":
+			c.Body = *o.bodyFile
+		case "data":
+			c.Data = *o.dataFile
+		case "signature":
+			c.Signature = *o.signatureLink
+		case "locale":
+			c.Locale = *o.locale
+		case "strict":
+			c.Strict = *o.strict
+		case "inline-css":
+			c.InlineCSS = *o.inlineCSS
+		case "subject":
+			c.Subject = *o.subject
+		case "preheader":
+			c.Preheader = *o.preheader
+		case "provider":
+			c.Sender.Provider = *o.provider
+		case "profile":
+			c.Sender.Profile = ""
+			c.Sender.Profiles = nil
+			for _, name := range strings.Split(*o.profile, ",") {
+				if name = strings.TrimSpace(name); name != "" {
+					c.Sender.Profiles = append(c.Sender.Profiles, name)
+				}
+			}
+		case "rate-interval":
+			c.RateLimit.Interval = *o.rateInterval
+		case "rate-burst":
+			c.RateLimit.Burst = *o.rateBurst
+		case "send-at":
+			c.Schedule.SendAt = *o.sendAt
+		case "window":
+			c.Schedule.Window = *o.window
+		case "timezone":
+			c.Schedule.Timezone = *o.timezone
+		case "header":
+			if c.Headers == nil {
+				c.Headers = make(map[string]string)
+			}
+			for _, header := range o.headers {
+				key, value, found := strings.Cut(header, ":")
+				if !found {
+					flagErr = fmt.Errorf("invalid -header %q, expected \"Key: Value\"", header)
+					return
+				}
+				if strings.ContainsAny(value, "\r\n") {
+					flagErr = fmt.Errorf("invalid -header %q, line breaks are not allowed", header)
+					return
+				}
+				c.Headers[strings.TrimSpace(key)] = strings.TrimSpace(value)
+			}
+		case "webhook":
+			for _, url := range o.webhooks {
+				c.Webhooks = append(c.Webhooks, campaign.Webhook{URL: url, SecretSource: *o.webhookSecret})
+			}
+		case "attach":
+			for _, file := range o.attachments {
+				c.Attachments = append(c.Attachments, campaign.Attachment{
+					File:         file,
+					ContentType:  mime.TypeByExtension(filepath.Ext(file)),
+					ContentID:    filepath.Base(file),
+					Base64Encode: true,
+				})
+			}
+		}
+	})
+	if flagErr != nil {
+		return campaign.Campaign{}, flagErr
+	}
+
+	if err := c.Validate(); err != nil {
+		return campaign.Campaign{}, err
+	}
+
+	return c, nil
+}
+
+func loadTemplate(c campaign.Campaign) (mailer.EmailTemplate, error) {
+	templateContent, err := templateBuilder(c, c.Dir, c.Body).Build()
+	if err != nil {
+		return mailer.EmailTemplate{}, fmt.Errorf("could not create email template: %v", err)
+	}
+	return templateContent, nil
+}
+
+// templateBuilder creates the builder of a body of a template directory with
+// the options of the campaign.
+func templateBuilder(c campaign.Campaign, dir, body string) mailer.EmailTemplateBuilder {
+	return c.TemplateBuilder(templatesRoot, dir, body)
+}
+
+func loadRecords(c campaign.Campaign) ([]parser.MailRecord, error) {
+	dataFilePath := path.Join(templatesRoot, c.Dir, "data", c.Data)
+	records, err := parser.ParseRecords(dataFilePath)
+	if err != nil {
+		return nil, fmt.Errorf("could not parse CSV file: %v", err)
+	}
+	return records, nil
+}
+
+const defaultStateDir = ".gopher-lite-mailer"
+
+// senderOptions holds the flags of the commands that send emails.
+type senderOptions struct {
+	flags          *flag.FlagSet
+	passwordSource *string
+	profilesFile   *string
+	stateDir       *string
+}
+
+func newSenderOptions(fs *flag.FlagSet) *senderOptions {
+	return &senderOptions{
+		flags:          fs,
+		passwordSource: fs.String("password-source", "prompt", "Where to read the password from: env:NAME, file:PATH (permissions 0600), prompt or keyring[:SERVICE]"),
+		profilesFile:   fs.String("profiles", "profiles.yaml", "File with the sender profiles"),
+		stateDir:       fs.String("state-dir", defaultStateDir, "Directory where the daily quota usage and the pending schedules are kept"),
+	}
+}
+
+// webhookNotifier creates the notifier of the webhooks of the campaign,
+// reading their secrets.
+func webhookNotifier(c campaign.Campaign) (*webhook.Notifier, error) {
+	var endpoints []webhook.Endpoint
+	for _, hook := range c.Webhooks {
+		endpoint := webhook.Endpoint{URL: hook.URL}
+		for _, event := range hook.Events {
+			endpoint.Events = append(endpoint.Events, webhook.EventType(event))
+		}
+		if hook.SecretSource != "" {
+			source, err := credentials.Parse(hook.SecretSource)
+			if err != nil {
+				return nil, err
+			}
+			endpoint.Secret, err = source.Password("webhook")
+			if err != nil {
+				return nil, fmt.Errorf("could not get webhook secret from %s: %v", source, err)
+			}
+		}
+		endpoints = append(endpoints, endpoint)
+	}
+	return webhook.NewNotifier(endpoints...), nil
+}
+
+// telemetryOptions holds the -metrics-addr and -trace flags of the commands
+// that send for a long time.
+type telemetryOptions struct {
+	metricsAddr *string
+	trace       *string
+}
+
+func newTelemetryOptions(fs *flag.FlagSet) *telemetryOptions {
+	return &telemetryOptions{
+		metricsAddr: fs.String("metrics-addr", "", "Address to serve Prometheus metrics on /metrics, e.g. localhost:9090 (disabled by default)"),
+		trace:       fs.String("trace", "", "Export OpenTelemetry traces to otlp (OTEL_EXPORTER_OTLP_ENDPOINT, localhost:4318 by default) or stdout (disabled by default)"),
+	}
+}
+
+// start serves the metrics until the context is done and sets up tracing, as
+// enabled by the flags. The returned function flushes the pending spans.
+func (o *telemetryOptions) start(ctx context.Context) (func(), error) {
+	exporter, err := tracing.ParseExporter(*o.trace)
+	if err != nil {
+		return nil, err
+	}
+
+	if *o.metricsAddr != "" {
+		if err := metrics.Serve(ctx, *o.metricsAddr); err != nil {
+			return nil, err
+		}
+	}
+
+	shutdown, err := tracing.Setup(ctx, exporter, os.Stdout)
+	if err != nil {
+		return nil, err
+	}
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdown(ctx); err != nil {
+			slog.Warn("could not export traces", slog.Any("error", err))
+		}
+	}, nil
+}
+
+// pool builds the sender accounts of the campaign, either from its profiles
+// or from the email given in the positional arguments. It also returns the
+// rate limit to send with, which is the stricter of the campaign and profile
+// ones.
+func (o *senderOptions) pool(c campaign.Campaign, args []string) (*mailer.Pool, campaign.RateLimit, error) {
+	rateLimit := c.RateLimit
+
+	store, err := quota.Open(o.statePath("quota.json"))
+	if err != nil {
+		return nil, rateLimit, err
+	}
+
+	profileNames := c.Sender.ProfileNames()
+	if len(profileNames) == 0 {
+		account, err := o.emailAccount(c, args)
+		if err != nil {
+			return nil, rateLimit, err
+		}
+		return mailer.NewPool(account).WithQuotaTracker(store), rateLimit, nil
+	}
+
+	if len(args) > 0 {
+		return nil, rateLimit, fmt.Errorf("sender email must not be given when using a profile")
+	}
+
+	profiles, err := profile.Load(*o.profilesFile)
+	if err != nil {
+		return nil, rateLimit, err
+	}
+
+	var accounts []mailer.Account
+	for _, name := range profileNames {
+		p, err := profiles.Get(name)
+		if err != nil {
+			return nil, rateLimit, err
+		}
+
+		// Servers without authentication, such as a local relay, need no
+		// password, so none is asked for.
+		var password string
+		if mailer.AuthMethod(p.Auth) != mailer.AuthNone {
+			sourceValue := *o.passwordSource
+			if p.PasswordSource != "" && !o.isSet("password-source") {
+				sourceValue = p.PasswordSource
+			}
+			password, err = readPassword(sourceValue, p.From)
+			if err != nil {
+				return nil, rateLimit, err
+			}
+		}
+
+		accounts = append(accounts, mailer.Account{
+			Name:       name,
+			Mailer:     withCampaign(p.Builder(password), c).Build(),
+			DailyQuota: p.Quota(),
+		})
+		rateLimit = stricterRateLimit(rateLimit, p.RateLimit)
+	}
+
+	return mailer.NewPool(accounts...).WithQuotaTracker(store), rateLimit, nil
+}
+
+func (o *senderOptions) emailAccount(c campaign.Campaign, args []string) (mailer.Account, error) {
+	var email string
+	switch {
+	case len(args) == 1:
+		email = args[0]
+	case len(args) == 0 && c.Sender.Email != "":
+		email = c.Sender.Email
+	default:
+		return mailer.Account{}, fmt.Errorf("sender email or profile is required")
+	}
+
+	password, err := readPassword(*o.passwordSource, email)
+	if err != nil {
+		return mailer.Account{}, err
+	}
+
+	var builder mailer.MailerBuilder
+	if c.Sender.Provider == "outlook" {
+		builder = mailer.NewOutlookMailerBuilder(email, password)
+	} else {
+		builder = mailer.NewGMailMailerBuilder(email, password)
+	}
+
+	return mailer.Account{
+		Name:       email,
+		Mailer:     withCampaign(builder, c).Build(),
+		DailyQuota: profile.Profile{Provider: c.Sender.Provider}.Quota(),
+	}, nil
+}
+
+// withCampaign adds the custom headers and attachments of the campaign.
+func withCampaign(builder mailer.MailerBuilder, c campaign.Campaign) mailer.MailerBuilder {
+	for key, value := range c.Headers {
+		builder = builder.WithHeader(key, value)
+	}
+	for _, attachment := range c.Attachments {
+		builder = builder.WithAttachment(attachment.File, attachment.ContentType, attachment.ContentID, attachment.Base64Encode)
+	}
+	return builder
+}
+
+func (o *senderOptions) statePath(name string) string {
+	return filepath.Join(*o.stateDir, name)
+}
+
+// schedule returns the schedule of the campaign. A schedule given by the
+// campaign or the flags is saved in the state directory, and when none is
+// given the saved one is used, so a restarted process keeps waiting for the
+// same time and window.
+func (o *senderOptions) schedule(c campaign.Campaign) (schedule.Schedule, *schedule.State, error) {
+	state, err := schedule.LoadState(o.statePath("schedule.json"))
+	if err != nil {
+		return schedule.Schedule{}, nil, err
+	}
+
+	entry := schedule.Entry{
+		SendAt:   c.Schedule.SendAt,
+		Window:   c.Schedule.Window,
+		Timezone: c.Schedule.Timezone,
+	}
+	saved, _ := state.Get(c.Key())
+	if entry.IsZero() {
+		if !saved.IsZero() {
+			slog.Info("⏰ Resuming saved schedule", slog.String(logging.KeyCampaign, c.Key()), slog.String("send_at", saved.SendAt), slog.String("window", saved.Window))
+		}
+		entry = saved
+	} else {
+		entry.Sent = saved.Sent
+		if err := state.Set(c.Key(), entry); err != nil {
+			return schedule.Schedule{}, nil, err
+		}
+	}
+
+	s, err := entry.Schedule()
+	if err != nil {
+		return schedule.Schedule{}, nil, err
+	}
+	return s, state, nil
+}
+
+func (o *senderOptions) isSet(name string) bool {
+	set := false
+	o.flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+func readPassword(sourceValue, account string) (string, error) {
+	source, err := credentials.Parse(sourceValue)
+	if err != nil {
+		return "", err
+	}
+
+	password, err := source.Password(account)
+	if err != nil {
+		return "", fmt.Errorf("could not get password from %s: %v", source, err)
+	}
+	return password, nil
+}
+
+// stricterRateLimit combines the campaign rate limit with the one of the
+// sender account, so a campaign can never send faster than its account allows.
+func stricterRateLimit(c campaign.RateLimit, p profile.RateLimit) campaign.RateLimit {
+	if p.Interval > c.Interval {
+		c.Interval = p.Interval
+	}
+	if p.Burst > 0 && p.Burst < c.Burst {
+		c.Burst = p.Burst
+	}
+	return c
+}
+
+// stringList is a flag.Value that collects every occurrence of a repeated flag.
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ", ")
+}
+
+func (l *stringList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
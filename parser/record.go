@@ -3,13 +3,19 @@ package parser
 import (
 	"encoding/csv"
 	"fmt"
+	"io"
 	"os"
+	"slices"
 	"strings"
+	"time"
 )
 
 type MailRecord struct {
 	Email string
 	Data  map[string]string
+	// Timezone is the location of the recipient, read from the optional
+	// "timezone" column. It is nil when the column is missing or empty.
+	Timezone *time.Location
 }
 
 func ParseRecords(path string) ([]MailRecord, error) {
@@ -19,7 +25,13 @@ func ParseRecords(path string) ([]MailRecord, error) {
 	}
 	defer file.Close()
 
-	reader := csv.NewReader(file)
+	return ReadRecords(file)
+}
+
+// ReadRecords reads records in the CSV format of ParseRecords from r, such as
+// an uploaded file.
+func ReadRecords(r io.Reader) ([]MailRecord, error) {
+	reader := csv.NewReader(r)
 	rows, err := reader.ReadAll()
 	if err != nil {
 		return nil, fmt.Errorf("could not read file: %v", err)
@@ -35,8 +47,10 @@ func ParseRecords(path string) ([]MailRecord, error) {
 		return nil, fmt.Errorf("no email column found in header")
 	}
 
+	timezoneIndex := findColumnIndex(headers, "timezone")
+
 	var records []MailRecord
-	for _, row := range rows[1:] {
+	for i, row := range rows[1:] {
 		if emailIndex >= len(row) {
 			return nil, fmt.Errorf("email column index out of range for row: %v", row)
 		}
@@ -47,15 +61,45 @@ func ParseRecords(path string) ([]MailRecord, error) {
 		for i, value := range row {
 			record.Data[strings.TrimSpace(headers[i])] = strings.TrimSpace(value)
 		}
+
+		if timezoneIndex != -1 && timezoneIndex < len(row) {
+			if name := strings.TrimSpace(row[timezoneIndex]); name != "" {
+				loc, err := time.LoadLocation(name)
+				if err != nil {
+					// Data rows start on the second line, right after the header.
+					return nil, fmt.Errorf("invalid timezone %q on line %d: %v", name, i+2, err)
+				}
+				record.Timezone = loc
+			}
+		}
+
 		records = append(records, record)
 	}
 
 	return records, nil
 }
 
+// Fields returns the columns of the records, sorted. Every record has the
+// same columns, the header of the CSV file.
+func Fields(records []MailRecord) []string {
+	if len(records) == 0 {
+		return nil
+	}
+	fields := make([]string, 0, len(records[0].Data))
+	for field := range records[0].Data {
+		fields = append(fields, field)
+	}
+	slices.Sort(fields)
+	return fields
+}
+
 func findEmailIndex(headers []string) int {
+	return findColumnIndex(headers, "email")
+}
+
+func findColumnIndex(headers []string, name string) int {
 	for i, header := range headers {
-		if strings.ToLower(header) == "email" {
+		if strings.ToLower(strings.TrimSpace(header)) == name {
 			return i
 		}
 	}
@@ -5,6 +5,7 @@ import (
 	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/reneepc/gopher-lite-mailer/parser"
 )
@@ -86,6 +87,51 @@ func TestParseRecords(t *testing.T) {
 			},
 			expectError: false,
 		},
+		"Timezone Column": {
+			content: [][]string{
+				{"Email", "Nome", "Timezone"},
+				{"rene.epcrdz@gmail.com", "Renê Cardozo", "America/Sao_Paulo"},
+				{"joao@example.pt", "João", "Europe/Lisbon"},
+				{"jorge@example.com", "Jorge", ""},
+			},
+			expected: []parser.MailRecord{
+				{
+					Email: "rene.epcrdz@gmail.com",
+					Data: map[string]string{
+						"Email":    "rene.epcrdz@gmail.com",
+						"Nome":     "Renê Cardozo",
+						"Timezone": "America/Sao_Paulo",
+					},
+					Timezone: mustLoadLocation(t, "America/Sao_Paulo"),
+				},
+				{
+					Email: "joao@example.pt",
+					Data: map[string]string{
+						"Email":    "joao@example.pt",
+						"Nome":     "João",
+						"Timezone": "Europe/Lisbon",
+					},
+					Timezone: mustLoadLocation(t, "Europe/Lisbon"),
+				},
+				{
+					Email: "jorge@example.com",
+					Data: map[string]string{
+						"Email":    "jorge@example.com",
+						"Nome":     "Jorge",
+						"Timezone": "",
+					},
+				},
+			},
+			expectError: false,
+		},
+		"Invalid Timezone": {
+			content: [][]string{
+				{"Email", "Nome", "timezone"},
+				{"rene.epcrdz@gmail.com", "Renê Cardozo", "America/Campinas"},
+			},
+			expected:    nil,
+			expectError: true,
+		},
 		"File Open Error": {
 			content:     nil,
 			expected:    nil,
@@ -124,6 +170,16 @@ func TestParseRecords(t *testing.T) {
 	}
 }
 
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("Failed to load location %s: %v", name, err)
+	}
+	return loc
+}
+
 func corruptFileForReadAll(t *testing.T, tmpFilePath string) {
 	t.Helper()
 
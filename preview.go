@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+func runPreview(args []string) error {
+	fs := newFlagSet("preview", "",
+		"Renders the email of a single recipient of the data file as HTML, without sending it.")
+	opts := newCampaignOptions(fs)
+	row := fs.Int("row", 1, "Data row to render, starting at 1 for the first row after the header")
+	out := fs.String("out", "", "File to write the rendered HTML to (defaults to the standard output)")
+	fs.Parse(args)
+
+	c, err := opts.campaign()
+	if err != nil {
+		return err
+	}
+
+	templateContent, err := loadTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	records, err := loadRecords(c)
+	if err != nil {
+		return err
+	}
+
+	if *row < 1 || *row > len(records) {
+		return fmt.Errorf("row %d out of range, the data file has %d rows", *row, len(records))
+	}
+
+	body, err := templateContent.Execute(records[*row-1].Data)
+	if err != nil {
+		return fmt.Errorf("could not execute template: %v", err)
+	}
+
+	if *out == "" {
+		fmt.Println(body)
+		return nil
+	}
+
+	if err := os.WriteFile(*out, []byte(body), 0644); err != nil {
+		return fmt.Errorf("could not write preview: %v", err)
+	}
+	fmt.Printf("📄 Preview for %s written to %s\n", records[*row-1].Email, *out)
+	return nil
+}
@@ -0,0 +1,202 @@
+package profile
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"gopkg.in/yaml.v3"
+)
+
+// Profile describes a sender account: how to reach its SMTP server, how to
+// authenticate and how its emails are addressed.
+type Profile struct {
+	Provider       string    `yaml:"provider"`
+	Host           string    `yaml:"host"`
+	Port           int       `yaml:"port"`
+	TLS            string    `yaml:"tls"`
+	Auth           string    `yaml:"auth"`
+	From           string    `yaml:"from"`
+	DisplayName    string    `yaml:"display_name"`
+	ReplyTo        string    `yaml:"reply_to"`
+	PasswordSource string    `yaml:"password_source"`
+	RateLimit      RateLimit `yaml:"rate_limit"`
+	DailyQuota     int       `yaml:"daily_quota"`
+}
+
+// RateLimit is the sending limit of the account. Zero values mean no limit.
+type RateLimit struct {
+	Interval time.Duration `yaml:"interval"`
+	Burst    int           `yaml:"burst"`
+}
+
+type preset struct {
+	host       string
+	port       int
+	tls        mailer.TLSMode
+	auth       mailer.AuthMethod
+	dailyQuota int
+}
+
+var presets = map[string]preset{
+	"gmail":   {host: "smtp.gmail.com", port: 587, tls: mailer.TLSModeStartTLS, auth: mailer.AuthPlain, dailyQuota: 500},
+	"outlook": {host: "smtp-mail.outlook.com", port: 587, tls: mailer.TLSModeStartTLS, auth: mailer.AuthLogin, dailyQuota: 300},
+}
+
+// Profiles maps profile names to their definition.
+type Profiles map[string]Profile
+
+type file struct {
+	Profiles Profiles `yaml:"profiles"`
+}
+
+// Load reads a YAML file with a top level "profiles" mapping of names to
+// profiles. Unknown fields are rejected with the line they appear on.
+func Load(path string) (Profiles, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("could not read profiles file: %v", err)
+	}
+
+	var f file
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+
+	var errs []error
+	for _, name := range f.Profiles.Names() {
+		if err := f.Profiles[name].Validate(); err != nil {
+			errs = append(errs, fmt.Errorf("profile %s: %v", name, err))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("invalid profiles %s:\n%v", path, errors.Join(errs...))
+	}
+
+	return f.Profiles, nil
+}
+
+// Get returns the profile with the given name.
+func (p Profiles) Get(name string) (Profile, error) {
+	profile, ok := p[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("unknown profile %q", name)
+	}
+	return profile, nil
+}
+
+// Names returns the profile names in alphabetical order.
+func (p Profiles) Names() []string {
+	names := make([]string, 0, len(p))
+	for name := range p {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Validate checks that the profile either uses a known provider or defines
+// its own host and port, and that its modes and addresses are valid.
+func (p Profile) Validate() error {
+	var errs []error
+
+	if p.Provider != "" {
+		if _, ok := presets[p.Provider]; !ok {
+			errs = append(errs, fmt.Errorf("provider: unknown provider %q, expected gmail or outlook", p.Provider))
+		}
+	} else {
+		if p.Host == "" {
+			errs = append(errs, errors.New("host: is required when no provider is given"))
+		}
+		if p.Port == 0 {
+			errs = append(errs, errors.New("port: is required when no provider is given"))
+		}
+	}
+
+	switch mailer.TLSMode(p.TLS) {
+	case "", mailer.TLSModeStartTLS, mailer.TLSModeImplicit, mailer.TLSModeNone:
+	default:
+		errs = append(errs, fmt.Errorf("tls: unknown mode %q, expected starttls, tls or none", p.TLS))
+	}
+
+	switch mailer.AuthMethod(p.Auth) {
+	case "", mailer.AuthPlain, mailer.AuthLogin, mailer.AuthCRAMMD5, mailer.AuthNone:
+	default:
+		errs = append(errs, fmt.Errorf("auth: unknown method %q, expected plain, login, cram-md5 or none", p.Auth))
+	}
+
+	if p.From == "" {
+		errs = append(errs, errors.New("from: is required"))
+	} else if _, err := mail.ParseAddress(p.From); err != nil {
+		errs = append(errs, fmt.Errorf("from: invalid address %q", p.From))
+	}
+	if p.ReplyTo != "" {
+		if _, err := mail.ParseAddress(p.ReplyTo); err != nil {
+			errs = append(errs, fmt.Errorf("reply_to: invalid address %q", p.ReplyTo))
+		}
+	}
+
+	if p.RateLimit.Interval < 0 {
+		errs = append(errs, errors.New("rate_limit.interval: must not be negative"))
+	}
+	if p.RateLimit.Burst < 0 {
+		errs = append(errs, errors.New("rate_limit.burst: must not be negative"))
+	}
+	if p.DailyQuota < 0 {
+		errs = append(errs, errors.New("daily_quota: must not be negative"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Quota returns the number of emails the account can send per day, which
+// defaults to the limit of its provider. Zero means no limit.
+func (p Profile) Quota() int {
+	if p.DailyQuota > 0 {
+		return p.DailyQuota
+	}
+	return presets[p.Provider].dailyQuota
+}
+
+// Builder returns a MailerBuilder for the profile. Fields left empty take the
+// values of the provider preset, and custom servers default to STARTTLS and
+// PLAIN authentication.
+func (p Profile) Builder(password string) mailer.MailerBuilder {
+	settings := preset{host: p.Host, port: p.Port, tls: mailer.TLSModeStartTLS, auth: mailer.AuthPlain}
+	if provider, ok := presets[p.Provider]; ok {
+		settings = provider
+		if p.Host != "" {
+			settings.host = p.Host
+		}
+		if p.Port != 0 {
+			settings.port = p.Port
+		}
+	}
+	if p.TLS != "" {
+		settings.tls = mailer.TLSMode(p.TLS)
+	}
+	if p.Auth != "" {
+		settings.auth = mailer.AuthMethod(p.Auth)
+	}
+
+	builder := mailer.NewMailerBuilder(settings.host, settings.port, p.From, password).
+		WithTLSMode(settings.tls).
+		WithAuthMethod(settings.auth)
+
+	if p.DisplayName != "" {
+		builder = builder.WithDisplayName(p.DisplayName)
+	}
+	if p.ReplyTo != "" {
+		builder = builder.WithReplyTo(p.ReplyTo)
+	}
+
+	return builder
+}
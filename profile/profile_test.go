@@ -0,0 +1,142 @@
+package profile_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/profile"
+)
+
+func createProfilesFile(t *testing.T, content string) string {
+	t.Helper()
+
+	filePath := filepath.Join(t.TempDir(), "profiles.yaml")
+	if err := os.WriteFile(filePath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to create profiles file: %v", err)
+	}
+
+	return filePath
+}
+
+func TestLoad(t *testing.T) {
+	tests := map[string]struct {
+		content       string
+		expected      profile.Profiles
+		expectedError string
+	}{
+		"Provider and Custom Profiles": {
+			content: `profiles:
+  golangsp-gmail:
+    provider: gmail
+    from: golangsp@gmail.com
+    display_name: Golang SP
+    reply_to: contato@golang.sampa.br
+    password_source: keyring
+    rate_limit:
+      interval: 3s
+      burst: 2
+  local:
+    host: localhost
+    port: 1025
+    tls: none
+    auth: none
+    from: test@localhost
+`,
+			expected: profile.Profiles{
+				"golangsp-gmail": {
+					Provider:       "gmail",
+					From:           "golangsp@gmail.com",
+					DisplayName:    "Golang SP",
+					ReplyTo:        "contato@golang.sampa.br",
+					PasswordSource: "keyring",
+					RateLimit:      profile.RateLimit{Interval: 3 * time.Second, Burst: 2},
+				},
+				"local": {
+					Host: "localhost",
+					Port: 1025,
+					TLS:  "none",
+					Auth: "none",
+					From: "test@localhost",
+				},
+			},
+		},
+		"Unknown Field": {
+			content:       "profiles:\n  gmail:\n    provider: gmail\n    form: golangsp@gmail.com\n",
+			expectedError: "line 4: field form not found",
+		},
+		"Unknown Provider": {
+			content:       "profiles:\n  yahoo:\n    provider: yahoo\n    from: golangsp@yahoo.com\n",
+			expectedError: "profile yahoo: provider: unknown provider \"yahoo\"",
+		},
+		"Custom Profile Without Host": {
+			content:       "profiles:\n  custom:\n    port: 25\n    from: golangsp@example.com\n",
+			expectedError: "profile custom: host: is required",
+		},
+		"Invalid TLS Mode": {
+			content:       "profiles:\n  gmail:\n    provider: gmail\n    tls: ssl\n    from: golangsp@gmail.com\n",
+			expectedError: "tls: unknown mode \"ssl\"",
+		},
+		"Missing From": {
+			content:       "profiles:\n  gmail:\n    provider: gmail\n",
+			expectedError: "from: is required",
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			profiles, err := profile.Load(createProfilesFile(t, tt.content))
+			if tt.expectedError != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.expectedError) {
+					t.Fatalf("expected error containing %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if len(profiles) != len(tt.expected) {
+				t.Fatalf("expected %d profiles, got %d", len(tt.expected), len(profiles))
+			}
+			for name, expected := range tt.expected {
+				if profiles[name] != expected {
+					t.Errorf("expected profile %s = %+v, got %+v", name, expected, profiles[name])
+				}
+			}
+		})
+	}
+}
+
+func TestProfile_Quota(t *testing.T) {
+	tests := map[string]struct {
+		profile  profile.Profile
+		expected int
+	}{
+		"Gmail Default":   {profile: profile.Profile{Provider: "gmail"}, expected: 500},
+		"Gmail Custom":    {profile: profile.Profile{Provider: "gmail", DailyQuota: 2000}, expected: 2000},
+		"Custom Server":   {profile: profile.Profile{Host: "localhost", Port: 1025}, expected: 0},
+		"Outlook Default": {profile: profile.Profile{Provider: "outlook"}, expected: 300},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := tt.profile.Quota(); got != tt.expected {
+				t.Errorf("expected quota %d, got %d", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestProfiles_Get(t *testing.T) {
+	profiles := profile.Profiles{"gmail": {Provider: "gmail", From: "golangsp@gmail.com"}}
+
+	if _, err := profiles.Get("gmail"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if _, err := profiles.Get("outlook"); err == nil {
+		t.Errorf("expected error for unknown profile")
+	}
+}
@@ -0,0 +1,251 @@
+package progress
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+
+	"github.com/reneepc/gopher-lite-mailer/logging"
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+// RateWindow is the period over which the current sending rate is measured.
+const RateWindow = time.Minute
+
+// Progress tracks the results of a campaign and shows its counts, current
+// rate, ETA and last error. On a terminal it redraws a status line in place,
+// otherwise it logs a summary periodically.
+type Progress struct {
+	out      io.Writer
+	terminal bool
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	total     int
+	sent      int
+	failed    int
+	skipped   int
+	startedAt time.Time
+	finished  []time.Time
+	lastError string
+	drawn     bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates the progress of a campaign of total emails shown on out. The
+// status line is used when out is a terminal, and the summary is logged every
+// interval otherwise.
+func New(out io.Writer, total int, interval time.Duration) *Progress {
+	terminal := false
+	if f, ok := out.(*os.File); ok {
+		terminal = term.IsTerminal(int(f.Fd()))
+	}
+	if terminal {
+		interval = time.Second
+	}
+
+	return &Progress{
+		out:       out,
+		terminal:  terminal,
+		interval:  interval,
+		now:       time.Now,
+		total:     total,
+		startedAt: time.Now(),
+	}
+}
+
+// Snapshot is the state of the campaign at a given time.
+type Snapshot struct {
+	Total   int
+	Sent    int
+	Failed  int
+	Skipped int
+	Pending int
+	// Rate is the number of emails sent or failed per minute over the last
+	// RateWindow.
+	Rate float64
+	// ETA is the estimated time to send the pending emails at the current
+	// rate, or zero when the rate is unknown.
+	ETA       time.Duration
+	Elapsed   time.Duration
+	LastError string
+}
+
+// Record counts the result of an email.
+func (p *Progress) Record(result mailer.RecordResult) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	switch result.Status {
+	case mailer.StatusSent:
+		p.sent++
+	case mailer.StatusFailed:
+		p.failed++
+		p.lastError = logging.RedactEmails(fmt.Sprintf("%s: %v", result.Record.Email, result.Err))
+	case mailer.StatusSkipped:
+		p.skipped++
+		return
+	}
+	p.finished = append(p.finished, p.now())
+}
+
+// Snapshot returns the current state of the campaign.
+func (p *Progress) Snapshot() Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.snapshot()
+}
+
+// snapshot is Snapshot for callers holding mu.
+func (p *Progress) snapshot() Snapshot {
+	now := p.now()
+	s := Snapshot{
+		Total:     p.total,
+		Sent:      p.sent,
+		Failed:    p.failed,
+		Skipped:   p.skipped,
+		Pending:   max(p.total-p.sent-p.failed-p.skipped, 0),
+		Elapsed:   now.Sub(p.startedAt),
+		LastError: p.lastError,
+	}
+
+	// Only the emails within the window count, so the rate reflects pauses of
+	// the schedule and the quota instead of the average since the start.
+	cutoff := now.Add(-RateWindow)
+	first := 0
+	for first < len(p.finished) && p.finished[first].Before(cutoff) {
+		first++
+	}
+	p.finished = p.finished[first:]
+
+	window := min(s.Elapsed, RateWindow)
+	if len(p.finished) > 0 && window > 0 {
+		s.Rate = float64(len(p.finished)) / window.Minutes()
+		s.ETA = time.Duration(float64(s.Pending) / s.Rate * float64(time.Minute)).Round(time.Second)
+	}
+	return s
+}
+
+func (s Snapshot) String() string {
+	eta := "unknown"
+	if s.ETA > 0 {
+		eta = s.ETA.String()
+	} else if s.Pending == 0 {
+		eta = "done"
+	}
+
+	line := fmt.Sprintf("📬 %d/%d sent, %d failed, %d pending", s.Sent, s.Total, s.Failed, s.Pending)
+	if s.Skipped > 0 {
+		line += fmt.Sprintf(", %d skipped", s.Skipped)
+	}
+	line += fmt.Sprintf(" | %.1f/min | ETA %s", s.Rate, eta)
+	if s.LastError != "" {
+		line += " | last error: " + s.LastError
+	}
+	return line
+}
+
+// Start shows the progress until Stop is called.
+func (p *Progress) Start() {
+	p.stop = make(chan struct{})
+	p.done = make(chan struct{})
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+
+		p.show()
+		for {
+			select {
+			case <-ticker.C:
+				p.show()
+			case <-p.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop stops showing the progress and shows its final state.
+func (p *Progress) Stop() {
+	close(p.stop)
+	<-p.done
+
+	p.mu.Lock()
+	p.clear()
+	s := p.snapshot()
+	p.mu.Unlock()
+
+	// The logger may write through p, so it is not called while holding mu.
+	slog.Info(s.String())
+}
+
+func (p *Progress) show() {
+	p.mu.Lock()
+	if p.terminal {
+		p.draw()
+		p.mu.Unlock()
+		return
+	}
+	s := p.snapshot()
+	p.mu.Unlock()
+
+	slog.Info("📊 Progress", slog.Int("sent", s.Sent), slog.Int("failed", s.Failed), slog.Int("pending", s.Pending),
+		slog.Int("total", s.Total), slog.String("rate", fmt.Sprintf("%.1f/min", s.Rate)), slog.Duration("eta", s.ETA),
+		slog.String("last_error", s.LastError))
+}
+
+// draw replaces the status line. Callers must hold mu.
+func (p *Progress) draw() {
+	line := p.snapshot().String()
+	if f, ok := p.out.(*os.File); ok {
+		if width, _, err := term.GetSize(int(f.Fd())); err == nil && width > 1 {
+			line = truncate(line, width-1)
+		}
+	}
+	fmt.Fprint(p.out, "\r\033[K"+line)
+	p.drawn = true
+}
+
+// clear erases the status line. Callers must hold mu.
+func (p *Progress) clear() {
+	if p.drawn {
+		fmt.Fprint(p.out, "\r\033[K")
+		p.drawn = false
+	}
+}
+
+// Write writes log lines above the status line, so they do not mix with it.
+// It is meant to be the output of the logger while the progress is shown.
+func (p *Progress) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if !p.terminal || !p.drawn {
+		return p.out.Write(b)
+	}
+
+	p.clear()
+	n, err := p.out.Write(b)
+	p.draw()
+	return n, err
+}
+
+func truncate(line string, width int) string {
+	if utf8.RuneCountInString(line) <= width {
+		return line
+	}
+	runes := []rune(line)
+	return strings.TrimSpace(string(runes[:width-1])) + "…"
+}
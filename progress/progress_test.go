@@ -0,0 +1,112 @@
+package progress
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/logging"
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+)
+
+func TestProgress_Snapshot(t *testing.T) {
+	start := time.Date(2024, 8, 6, 8, 0, 0, 0, time.UTC)
+	now := start
+
+	p := New(&bytes.Buffer{}, 10, time.Minute)
+	p.startedAt = start
+	p.now = func() time.Time { return now }
+
+	// One email every 2 seconds, as with the default rate limit.
+	for i := range 4 {
+		now = start.Add(time.Duration(i+1) * 2 * time.Second)
+		p.Record(mailer.RecordResult{Status: mailer.StatusSent})
+	}
+	now = start.Add(10 * time.Second)
+	p.Record(mailer.RecordResult{
+		Record: parser.MailRecord{Email: "ferris@example.com"},
+		Status: mailer.StatusFailed,
+		Err:    errors.New("550 5.1.1 No such user"),
+	})
+	p.Record(mailer.RecordResult{Status: mailer.StatusSkipped})
+
+	s := p.Snapshot()
+	if s.Sent != 4 || s.Failed != 1 || s.Skipped != 1 || s.Pending != 4 {
+		t.Errorf("unexpected counts: %+v", s)
+	}
+	if s.Rate != 30 {
+		t.Errorf("expected 30 emails per minute, got %v", s.Rate)
+	}
+	if s.ETA != 8*time.Second {
+		t.Errorf("expected an ETA of 8s, got %v", s.ETA)
+	}
+	if s.LastError != "ferris@example.com: 550 5.1.1 No such user" {
+		t.Errorf("unexpected last error: %q", s.LastError)
+	}
+
+	// After a pause longer than the window, the rate is unknown.
+	now = start.Add(10*time.Second + RateWindow + time.Second)
+	if s := p.Snapshot(); s.Rate != 0 || s.ETA != 0 || !strings.Contains(s.String(), "ETA unknown") {
+		t.Errorf("expected an unknown rate after a pause, got %+v (%s)", s, s)
+	}
+}
+
+func TestProgress_RedactedError(t *testing.T) {
+	if err := logging.SetEmails("mask"); err != nil {
+		t.Fatalf("Failed to set email mode: %v", err)
+	}
+	t.Cleanup(func() { logging.SetEmails("plain") })
+
+	p := New(&bytes.Buffer{}, 1, time.Minute)
+	p.Record(mailer.RecordResult{
+		Record: parser.MailRecord{Email: "ferris@example.com"},
+		Status: mailer.StatusFailed,
+		Err:    errors.New("550 5.1.1 <ferris@example.com>: No such user"),
+	})
+
+	if s := p.Snapshot(); s.LastError != "f****@example.com: 550 5.1.1 <f****@example.com>: No such user" {
+		t.Errorf("expected the addresses to be redacted like the logs, got %q", s.LastError)
+	}
+}
+
+func TestProgress_Write(t *testing.T) {
+	var out bytes.Buffer
+	p := New(&out, 2, time.Minute)
+	p.terminal = true
+
+	p.Record(mailer.RecordResult{Status: mailer.StatusSent})
+	p.show()
+	p.Write([]byte("log line\n"))
+
+	expected := "\r\033[K📬 1/2 sent, 0 failed, 1 pending"
+	if !strings.HasPrefix(out.String(), expected) {
+		t.Fatalf("expected the status line first, got %q", out.String())
+	}
+	// The status line is cleared before the log line and drawn again after it.
+	lines := strings.Split(out.String(), "\r\033[K")
+	if len(lines) != 4 || lines[2] != "log line\n" || !strings.HasPrefix(lines[3], "📬 1/2 sent") {
+		t.Errorf("expected the log line above the status line, got %q", out.String())
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := map[string]struct {
+		line     string
+		width    int
+		expected string
+	}{
+		"Fits":      {line: "📬 1/2 sent", width: 20, expected: "📬 1/2 sent"},
+		"Truncated": {line: "📬 1/2 sent, 0 failed", width: 11, expected: "📬 1/2 sent…"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := truncate(tt.line, tt.width); got != tt.expected {
+				t.Errorf("expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/profile"
+	"github.com/reneepc/gopher-lite-mailer/quota"
+)
+
+func runQuota(args []string) error {
+	fs := newFlagSet("quota", "",
+		"Shows how many emails each account sent in the last 24 hours and how much of its daily\n"+
+			"quota is left. Accounts are listed from the quota usage and from the profiles file.")
+	stateDir := fs.String("state-dir", defaultStateDir, "Directory where the daily quota usage of each account is kept")
+	profilesFile := fs.String("profiles", "profiles.yaml", "File with the sender profiles")
+	fs.Parse(args)
+
+	store, err := quota.Open(filepath.Join(*stateDir, "quota.json"))
+	if err != nil {
+		return err
+	}
+
+	profiles := profile.Profiles{}
+	if _, err := os.Stat(*profilesFile); err == nil {
+		profiles, err = profile.Load(*profilesFile)
+		if err != nil {
+			return err
+		}
+	}
+
+	limits := make(map[string]int)
+	var accounts []string
+	for _, name := range profiles.Names() {
+		p := profiles[name]
+		if _, ok := limits[p.From]; !ok {
+			accounts = append(accounts, p.From)
+		}
+		limits[p.From] = p.Quota()
+	}
+	for _, account := range store.Accounts() {
+		if _, ok := limits[account]; !ok {
+			accounts = append(accounts, account)
+			limits[account] = 0
+		}
+	}
+
+	if len(accounts) == 0 {
+		fmt.Println("No emails sent in the last 24 hours")
+		return nil
+	}
+
+	fmt.Printf("%-35s %6s %6s %9s  %s\n", "ACCOUNT", "USED", "QUOTA", "REMAINING", "NEXT RESET")
+	for _, account := range accounts {
+		used, limit := store.Used(account), limits[account]
+
+		quotaText, remainingText, resetText := "-", "-", "-"
+		if limit > 0 {
+			quotaText = fmt.Sprint(limit)
+			remainingText = fmt.Sprint(max(limit-used, 0))
+			if resetAt := store.ResetAt(account, limit); !resetAt.IsZero() {
+				resetText = resetAt.Local().Format(time.DateTime)
+			}
+		}
+
+		fmt.Printf("%-35s %6d %6s %9s  %s\n", account, used, quotaText, remainingText, resetText)
+	}
+
+	return nil
+}
@@ -0,0 +1,192 @@
+package quota
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/lockfile"
+)
+
+// Window is the period over which the emails of an account are counted.
+const Window = 24 * time.Hour
+
+// Store keeps the time of every email sent by each account within the last
+// Window in a JSON file, so the usage survives between runs.
+type Store struct {
+	path string
+	now  func() time.Time
+
+	mu   sync.Mutex
+	sent map[string][]time.Time
+}
+
+// Open loads the store from path. A missing file is an empty store.
+func Open(path string) (*Store, error) {
+	s := &Store{
+		path: path,
+		now:  time.Now,
+		sent: make(map[string][]time.Time),
+	}
+
+	sent, err := read(path)
+	if err != nil {
+		return nil, err
+	}
+	s.sent = sent
+
+	return s, nil
+}
+
+// read returns the send times saved in the file at path. A missing file has
+// none.
+func read(path string) (map[string][]time.Time, error) {
+	sent := make(map[string][]time.Time)
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sent, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read quota file: %v", err)
+	}
+
+	if err := json.Unmarshal(content, &sent); err != nil {
+		return nil, fmt.Errorf("could not parse quota file %s: %v", path, err)
+	}
+
+	return sent, nil
+}
+
+// Used returns the number of emails the account sent within the last Window.
+func (s *Store) Used(account string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.recent(account))
+}
+
+// ResetAt returns when the usage of the account will drop below limit, or the
+// zero time when it already is.
+func (s *Store) ResetAt(account string, limit int) time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sent := s.recent(account)
+	if len(sent) < limit || limit <= 0 {
+		return time.Time{}
+	}
+	return sent[len(sent)-limit].Add(Window)
+}
+
+// Record counts a sent email for the account and saves the store. Other
+// processes may share the file, such as the daemon and a send, so it is
+// locked and the emails they recorded since it was read are merged first.
+func (s *Store) Record(account string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	unlock, err := lockfile.Lock(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("could not lock quota file: %v", err)
+	}
+	defer unlock()
+
+	saved, err := read(s.path)
+	if err != nil {
+		return err
+	}
+	for account, sent := range saved {
+		s.sent[account] = merge(s.sent[account], sent)
+	}
+
+	s.sent[account] = append(s.recent(account), s.now())
+	return s.save()
+}
+
+// Accounts returns the accounts with emails sent within the last Window.
+func (s *Store) Accounts() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var accounts []string
+	for account := range s.sent {
+		if len(s.recent(account)) > 0 {
+			accounts = append(accounts, account)
+		}
+	}
+	sort.Strings(accounts)
+	return accounts
+}
+
+// recent returns the send times of the account within the window, oldest
+// first. Callers must hold mu.
+func (s *Store) recent(account string) []time.Time {
+	since := s.now().Add(-Window)
+	sent := s.sent[account]
+
+	i := sort.Search(len(sent), func(i int) bool { return sent[i].After(since) })
+	return sent[i:]
+}
+
+// save writes the store to a temporary file and renames it over the previous
+// one, so an interrupted run never leaves a truncated file behind. Callers
+// must hold mu and the lock file.
+func (s *Store) save() error {
+	for account := range s.sent {
+		s.sent[account] = s.recent(account)
+		if len(s.sent[account]) == 0 {
+			delete(s.sent, account)
+		}
+	}
+
+	content, err := json.MarshalIndent(s.sent, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode quota file: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write quota file: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write quota file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write quota file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("could not write quota file: %v", err)
+	}
+
+	return nil
+}
+
+// merge returns the send times of both lists, oldest first and without the
+// ones they have in common.
+func merge(a, b []time.Time) []time.Time {
+	merged := make([]time.Time, 0, len(a)+len(b))
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || len(a) > 0 && a[0].Before(b[0]):
+			merged = append(merged, a[0])
+			a = a[1:]
+		case len(a) == 0 || b[0].Before(a[0]):
+			merged = append(merged, b[0])
+			b = b[1:]
+		default:
+			merged = append(merged, a[0])
+			a, b = a[1:], b[1:]
+		}
+	}
+	return merged
+}
@@ -0,0 +1,121 @@
+package quota
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "quota.json")
+	now := time.Date(2024, 8, 6, 8, 0, 0, 0, time.UTC)
+
+	store, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+	store.now = func() time.Time { return now }
+
+	for _, offset := range []time.Duration{-23 * time.Hour, -2 * time.Hour, 0} {
+		now = time.Date(2024, 8, 6, 8, 0, 0, 0, time.UTC).Add(offset)
+		if err := store.Record("golangsp@gmail.com"); err != nil {
+			t.Fatalf("Failed to record: %v", err)
+		}
+	}
+	now = time.Date(2024, 8, 6, 8, 0, 0, 0, time.UTC)
+
+	if used := store.Used("golangsp@gmail.com"); used != 3 {
+		t.Errorf("expected 3 emails used, got %d", used)
+	}
+	if used := store.Used("other@gmail.com"); used != 0 {
+		t.Errorf("expected no emails used by other account, got %d", used)
+	}
+
+	expectedReset := time.Date(2024, 8, 6, 9, 0, 0, 0, time.UTC)
+	if resetAt := store.ResetAt("golangsp@gmail.com", 3); !resetAt.Equal(expectedReset) {
+		t.Errorf("expected reset at %v, got %v", expectedReset, resetAt)
+	}
+	if resetAt := store.ResetAt("golangsp@gmail.com", 4); !resetAt.IsZero() {
+		t.Errorf("expected no reset below the limit, got %v", resetAt)
+	}
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	reopened.now = func() time.Time { return now.Add(90 * time.Minute) }
+
+	if used := reopened.Used("golangsp@gmail.com"); used != 2 {
+		t.Errorf("expected 2 emails used after the oldest left the window, got %d", used)
+	}
+	if accounts := reopened.Accounts(); len(accounts) != 1 || accounts[0] != "golangsp@gmail.com" {
+		t.Errorf("unexpected accounts %v", accounts)
+	}
+}
+
+func TestStore_SharedFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quota.json")
+
+	// Each store stands for a process, such as the daemon and a send, that
+	// opened the file before the other recorded its emails.
+	var stores []*Store
+	for range 3 {
+		store, err := Open(path)
+		if err != nil {
+			t.Fatalf("Failed to open store: %v", err)
+		}
+		stores = append(stores, store)
+	}
+
+	var wg sync.WaitGroup
+	for _, store := range stores {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if err := store.Record("golangsp@gmail.com"); err != nil {
+					t.Errorf("Failed to record: %v", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	reopened, err := Open(path)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	if used := reopened.Used("golangsp@gmail.com"); used != 60 {
+		t.Errorf("expected the 60 emails of every store, got %d", used)
+	}
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("Failed to read quota directory: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("expected only the quota file to be left, got %v", entries)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	dir := t.TempDir()
+
+	store, err := Open(filepath.Join(dir, "missing.json"))
+	if err != nil {
+		t.Fatalf("expected missing file to be an empty store, got %v", err)
+	}
+	if len(store.Accounts()) != 0 {
+		t.Errorf("expected empty store")
+	}
+
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(invalid, []byte("{"), 0600); err != nil {
+		t.Fatalf("Failed to create quota file: %v", err)
+	}
+	if _, err := Open(invalid); err == nil {
+		t.Errorf("expected error for invalid file")
+	}
+}
@@ -0,0 +1,290 @@
+package report
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+// Report lists the outcome of the email of every recipient of a campaign run.
+type Report struct {
+	Summary Summary `json:"summary"`
+	Rows    []Row   `json:"recipients"`
+}
+
+// Summary counts the recipients of a report by status.
+type Summary struct {
+	Campaign   string    `json:"campaign"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Total      int       `json:"total"`
+	Sent       int       `json:"sent"`
+	Failed     int       `json:"failed"`
+	Skipped    int       `json:"skipped"`
+}
+
+// Row is the outcome of the email of one recipient.
+type Row struct {
+	Email      string        `json:"email"`
+	Status     mailer.Status `json:"status"`
+	MessageID  string        `json:"message_id,omitempty"`
+	SMTPCode   int           `json:"smtp_code,omitempty"`
+	SMTPReply  string        `json:"smtp_reply,omitempty"`
+	Error      string        `json:"error,omitempty"`
+	Attempts   int           `json:"attempts"`
+	Account    string        `json:"account,omitempty"`
+	StartedAt  *time.Time    `json:"started_at,omitempty"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+}
+
+// New creates a report of the campaign from the results of its batch, in the
+// order of the records.
+func New(campaign string, startedAt time.Time, results []mailer.RecordResult) Report {
+	sorted := append([]mailer.RecordResult(nil), results...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Index < sorted[j].Index })
+
+	r := Report{Summary: Summary{Campaign: campaign, StartedAt: startedAt, FinishedAt: time.Now()}}
+	for _, result := range sorted {
+		r.Rows = append(r.Rows, rowFromResult(result))
+	}
+	r.summarize()
+	return r
+}
+
+func rowFromResult(result mailer.RecordResult) Row {
+	row := Row{
+		Email:     result.Record.Email,
+		Status:    result.Status,
+		MessageID: result.MessageID,
+		SMTPCode:  result.Code,
+		SMTPReply: result.Response,
+		Attempts:  result.Attempts,
+		Account:   result.Account,
+	}
+	if result.Err != nil {
+		row.Error = result.Err.Error()
+	}
+	if !result.StartedAt.IsZero() {
+		finishedAt := result.StartedAt.Add(result.Duration)
+		row.StartedAt = &result.StartedAt
+		row.FinishedAt = &finishedAt
+	}
+	return row
+}
+
+// Merge replaces the rows of the recipients in the results of a new run, such
+// as a retry, and keeps the others.
+func (r *Report) Merge(startedAt time.Time, results []mailer.RecordResult) {
+	retried := make(map[string]Row)
+	for _, result := range results {
+		retried[result.Record.Email] = rowFromResult(result)
+	}
+
+	for i, row := range r.Rows {
+		if newRow, ok := retried[row.Email]; ok {
+			r.Rows[i] = newRow
+		}
+	}
+
+	r.Summary.StartedAt = startedAt
+	r.Summary.FinishedAt = time.Now()
+	r.summarize()
+}
+
+// Emails returns the emails of the rows with one of the given statuses.
+func (r Report) Emails(statuses ...mailer.Status) map[string]bool {
+	emails := make(map[string]bool)
+	for _, row := range r.Rows {
+		for _, status := range statuses {
+			if row.Status == status {
+				emails[row.Email] = true
+			}
+		}
+	}
+	return emails
+}
+
+func (r *Report) summarize() {
+	r.Summary.Total = len(r.Rows)
+	r.Summary.Sent, r.Summary.Failed, r.Summary.Skipped = 0, 0, 0
+	for _, row := range r.Rows {
+		switch row.Status {
+		case mailer.StatusSent:
+			r.Summary.Sent++
+		case mailer.StatusFailed:
+			r.Summary.Failed++
+		case mailer.StatusSkipped:
+			r.Summary.Skipped++
+		}
+	}
+}
+
+// Write saves the report as JSON or CSV according to the extension of path.
+// In CSV, the summary is written before the header as comment lines starting
+// with "#".
+func (r Report) Write(path string) error {
+	var content []byte
+	var err error
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		content, err = json.MarshalIndent(r, "", "  ")
+		content = append(content, '\n')
+	case ".csv":
+		content, err = r.marshalCSV()
+	default:
+		return fmt.Errorf("unknown report format %q, expected .csv or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return fmt.Errorf("could not encode report: %v", err)
+	}
+
+	if err := os.WriteFile(path, content, 0644); err != nil {
+		return fmt.Errorf("could not write report: %v", err)
+	}
+	return nil
+}
+
+var csvHeader = []string{"email", "status", "message_id", "smtp_code", "smtp_reply", "error", "attempts", "account", "started_at", "finished_at"}
+
+func (r Report) marshalCSV() ([]byte, error) {
+	var b strings.Builder
+	s := r.Summary
+	fmt.Fprintf(&b, "# campaign: %s\n", s.Campaign)
+	fmt.Fprintf(&b, "# started_at: %s\n", formatTime(&s.StartedAt))
+	fmt.Fprintf(&b, "# finished_at: %s\n", formatTime(&s.FinishedAt))
+	fmt.Fprintf(&b, "# total: %d, sent: %d, failed: %d, skipped: %d\n", s.Total, s.Sent, s.Failed, s.Skipped)
+
+	w := csv.NewWriter(&b)
+	w.Write(csvHeader)
+	for _, row := range r.Rows {
+		code := ""
+		if row.SMTPCode != 0 {
+			code = strconv.Itoa(row.SMTPCode)
+		}
+		w.Write([]string{
+			row.Email,
+			string(row.Status),
+			row.MessageID,
+			code,
+			row.SMTPReply,
+			row.Error,
+			strconv.Itoa(row.Attempts),
+			row.Account,
+			formatTime(row.StartedAt),
+			formatTime(row.FinishedAt),
+		})
+	}
+	w.Flush()
+	return []byte(b.String()), w.Error()
+}
+
+// Read loads a report written by Write.
+func Read(path string) (Report, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return Report{}, fmt.Errorf("could not read report: %v", err)
+	}
+
+	var r Report
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		err = json.Unmarshal(content, &r)
+	case ".csv":
+		r, err = unmarshalCSV(string(content))
+	default:
+		return Report{}, fmt.Errorf("unknown report format %q, expected .csv or .json", filepath.Ext(path))
+	}
+	if err != nil {
+		return Report{}, fmt.Errorf("could not parse report %s: %v", path, err)
+	}
+
+	return r, nil
+}
+
+func unmarshalCSV(content string) (Report, error) {
+	var r Report
+	for _, line := range strings.Split(content, "\n") {
+		key, value, found := strings.Cut(strings.TrimPrefix(line, "# "), ": ")
+		if !strings.HasPrefix(line, "#") || !found {
+			continue
+		}
+		switch key {
+		case "campaign":
+			r.Summary.Campaign = value
+		case "started_at":
+			if t, err := parseTime(value); err == nil && t != nil {
+				r.Summary.StartedAt = *t
+			}
+		case "finished_at":
+			if t, err := parseTime(value); err == nil && t != nil {
+				r.Summary.FinishedAt = *t
+			}
+		}
+	}
+
+	reader := csv.NewReader(strings.NewReader(content))
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return Report{}, err
+	}
+	if len(records) == 0 || strings.Join(records[0], ",") != strings.Join(csvHeader, ",") {
+		return Report{}, errors.New("missing report header")
+	}
+
+	for _, record := range records[1:] {
+		row := Row{
+			Email:     record[0],
+			Status:    mailer.Status(record[1]),
+			MessageID: record[2],
+			SMTPReply: record[4],
+			Error:     record[5],
+			Account:   record[7],
+		}
+		if record[3] != "" {
+			if row.SMTPCode, err = strconv.Atoi(record[3]); err != nil {
+				return Report{}, fmt.Errorf("invalid smtp_code %q", record[3])
+			}
+		}
+		if row.Attempts, err = strconv.Atoi(record[6]); err != nil {
+			return Report{}, fmt.Errorf("invalid attempts %q", record[6])
+		}
+		if row.StartedAt, err = parseTime(record[8]); err != nil {
+			return Report{}, err
+		}
+		if row.FinishedAt, err = parseTime(record[9]); err != nil {
+			return Report{}, err
+		}
+		r.Rows = append(r.Rows, row)
+	}
+
+	r.summarize()
+	return r, nil
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339Nano)
+}
+
+func parseTime(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("invalid time %q", value)
+	}
+	return &t, nil
+}
@@ -0,0 +1,140 @@
+package report_test
+
+import (
+	"errors"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+	"github.com/reneepc/gopher-lite-mailer/report"
+)
+
+func testResults() []mailer.RecordResult {
+	startedAt := time.Date(2024, 8, 6, 8, 0, 0, 0, time.UTC)
+	return []mailer.RecordResult{
+		{
+			Index:     1,
+			Record:    parser.MailRecord{Email: "ferris@example.com"},
+			Status:    mailer.StatusFailed,
+			Account:   "golangsp",
+			Attempts:  3,
+			Code:      550,
+			Response:  "5.1.1 No such user",
+			Err:       &textproto.Error{Code: 550, Msg: "5.1.1 No such user"},
+			StartedAt: startedAt.Add(time.Second),
+			Duration:  time.Second,
+		},
+		{
+			Index:     0,
+			Record:    parser.MailRecord{Email: "gopher@example.com"},
+			Status:    mailer.StatusSent,
+			Account:   "golangsp",
+			MessageID: "<1@example.com>",
+			Attempts:  1,
+			Code:      250,
+			Response:  "2.0.0 OK, queued",
+			StartedAt: startedAt,
+			Duration:  500 * time.Millisecond,
+		},
+		{
+			Index:  2,
+			Record: parser.MailRecord{Email: "gordon@example.com"},
+			Status: mailer.StatusSkipped,
+			Err:    errors.New("daily quota reached by every sender account"),
+		},
+	}
+}
+
+func TestReport_WriteAndRead(t *testing.T) {
+	startedAt := time.Date(2024, 8, 6, 7, 59, 0, 0, time.UTC)
+	r := report.New("standard/workshop-confirmation.html:data.csv", startedAt, testResults())
+
+	if r.Rows[0].Email != "gopher@example.com" || r.Rows[1].Email != "ferris@example.com" {
+		t.Errorf("expected rows in the order of the records, got %+v", r.Rows)
+	}
+	expectedSummary := report.Summary{Total: 3, Sent: 1, Failed: 1, Skipped: 1}
+	if r.Summary.Total != expectedSummary.Total || r.Summary.Sent != expectedSummary.Sent ||
+		r.Summary.Failed != expectedSummary.Failed || r.Summary.Skipped != expectedSummary.Skipped {
+		t.Errorf("unexpected summary: %+v", r.Summary)
+	}
+
+	for _, name := range []string{"report.csv", "report.json"} {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), name)
+			if err := r.Write(path); err != nil {
+				t.Fatalf("Failed to write report: %v", err)
+			}
+
+			read, err := report.Read(path)
+			if err != nil {
+				t.Fatalf("Failed to read report: %v", err)
+			}
+
+			summary := read.Summary
+			if summary.Campaign != r.Summary.Campaign || !summary.StartedAt.Equal(r.Summary.StartedAt) || !summary.FinishedAt.Equal(r.Summary.FinishedAt) ||
+				summary.Total != r.Summary.Total || summary.Sent != r.Summary.Sent || summary.Failed != r.Summary.Failed || summary.Skipped != r.Summary.Skipped {
+				t.Errorf("expected summary %+v, got %+v", r.Summary, read.Summary)
+			}
+			if len(read.Rows) != len(r.Rows) {
+				t.Fatalf("expected %d rows, got %d", len(r.Rows), len(read.Rows))
+			}
+			for i := range r.Rows {
+				expected, got := r.Rows[i], read.Rows[i]
+				if expected.Email != got.Email || expected.Status != got.Status || expected.SMTPCode != got.SMTPCode ||
+					expected.SMTPReply != got.SMTPReply || expected.Error != got.Error || expected.Attempts != got.Attempts ||
+					(expected.StartedAt == nil) != (got.StartedAt == nil) ||
+					(expected.FinishedAt != nil && !expected.FinishedAt.Equal(*got.FinishedAt)) {
+					t.Errorf("expected row %+v, got %+v", expected, got)
+				}
+			}
+		})
+	}
+
+	if err := r.Write(filepath.Join(t.TempDir(), "report.txt")); err == nil {
+		t.Error("expected unknown format error")
+	}
+}
+
+func TestReport_CSVSummary(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "report.csv")
+	if err := report.New("standard", time.Now(), testResults()).Write(path); err != nil {
+		t.Fatalf("Failed to write report: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read report: %v", err)
+	}
+	if !strings.Contains(string(content), "# total: 3, sent: 1, failed: 1, skipped: 1\n") {
+		t.Errorf("expected summary in report:\n%s", content)
+	}
+}
+
+func TestReport_Merge(t *testing.T) {
+	r := report.New("standard", time.Now(), testResults())
+
+	retry := []mailer.RecordResult{{
+		Record:    parser.MailRecord{Email: "ferris@example.com"},
+		Status:    mailer.StatusSent,
+		Attempts:  1,
+		Code:      250,
+		StartedAt: time.Now(),
+	}}
+	r.Merge(time.Now(), retry)
+
+	if r.Rows[1].Email != "ferris@example.com" || r.Rows[1].Status != mailer.StatusSent || r.Rows[1].Error != "" {
+		t.Errorf("expected the retried row to be replaced, got %+v", r.Rows[1])
+	}
+	if r.Summary.Sent != 2 || r.Summary.Failed != 0 || r.Summary.Skipped != 1 {
+		t.Errorf("unexpected summary after merge: %+v", r.Summary)
+	}
+
+	if emails := r.Emails(mailer.StatusSkipped); len(emails) != 1 || !emails["gordon@example.com"] {
+		t.Errorf("expected only the skipped email, got %v", emails)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+	"github.com/reneepc/gopher-lite-mailer/report"
+)
+
+func runRetryFailed(args []string) error {
+	fs := newFlagSet("retry-failed", "[email]",
+		"Sends the campaign again only to the recipients whose status is failed in the report\n"+
+			"of a previous run, and updates the report with the new results.")
+	opts := newCampaignOptions(fs)
+	sender := newSenderOptions(fs)
+	waitForQuota := fs.Bool("wait-for-quota", false, "Pause until the daily quota frees up instead of stopping when every account reached it")
+	reportFile := fs.String("report", "", "Report of the previous run, written by send -report (required)")
+	includeSkipped := fs.Bool("include-skipped", false, "Also send to the recipients skipped because of the daily quota")
+	telemetry := newTelemetryOptions(fs)
+	fs.Parse(args)
+
+	if *reportFile == "" {
+		fs.Usage()
+		return fmt.Errorf("-report is required")
+	}
+
+	c, err := opts.campaign()
+	if err != nil {
+		return err
+	}
+
+	previous, err := report.Read(*reportFile)
+	if err != nil {
+		return err
+	}
+	if previous.Summary.Campaign != "" && previous.Summary.Campaign != c.Key() {
+		return fmt.Errorf("report %s is of campaign %s, not %s", *reportFile, previous.Summary.Campaign, c.Key())
+	}
+
+	statuses := []mailer.Status{mailer.StatusFailed}
+	if *includeSkipped {
+		statuses = append(statuses, mailer.StatusSkipped)
+	}
+	retry := previous.Emails(statuses...)
+
+	allRecords, err := loadRecords(c)
+	if err != nil {
+		return err
+	}
+
+	var records []parser.MailRecord
+	for _, record := range allRecords {
+		if retry[record.Email] {
+			records = append(records, record)
+		}
+	}
+	if len(records) == 0 {
+		slog.Info("🎉 No recipients to retry", slog.String("report", *reportFile))
+		return nil
+	}
+	slog.Info("🔁 Retrying recipients", slog.Int("count", len(records)), slog.String("report", *reportFile))
+
+	stopTelemetry, err := telemetry.start(context.Background())
+	if err != nil {
+		return err
+	}
+	defer stopTelemetry()
+
+	startedAt := time.Now()
+	results, err := sendCampaign(context.Background(), c, sender, fs.Args(), records, *waitForQuota)
+	if err != nil {
+		return err
+	}
+
+	previous.Merge(startedAt, results)
+	if err := previous.Write(*reportFile); err != nil {
+		return err
+	}
+	slog.Info("📝 Report updated", slog.String("report", *reportFile),
+		slog.Int("sent", previous.Summary.Sent), slog.Int("failed", previous.Summary.Failed), slog.Int("skipped", previous.Summary.Skipped))
+	return nil
+}
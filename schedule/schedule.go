@@ -0,0 +1,214 @@
+package schedule
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// localLayouts are the accepted formats for times without a UTC offset, which
+// are read in the location of the schedule.
+var localLayouts = []string{
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+}
+
+// ParseTime reads a time in RFC 3339 format or, without a UTC offset, as a
+// wall clock time in loc.
+func ParseTime(value string, loc *time.Location) (time.Time, error) {
+	t, _, err := parseTime(value, loc)
+	return t, err
+}
+
+// parseTime is like ParseTime, also reporting whether the value was a wall
+// clock time.
+func parseTime(value string, loc *time.Location) (time.Time, bool, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, false, nil
+	}
+	for _, layout := range localLayouts {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, true, nil
+		}
+	}
+	return time.Time{}, false, fmt.Errorf("invalid time %q, expected e.g. 2024-08-06T08:00:00-03:00 or 2024-08-06 08:00", value)
+}
+
+// Window is a daily period in which emails may be sent, such as 08:00-21:00.
+// A window whose end is before its start spans midnight.
+type Window struct {
+	start time.Duration
+	end   time.Duration
+}
+
+// ParseWindow reads a window in the "HH:MM-HH:MM" format.
+func ParseWindow(value string) (Window, error) {
+	startText, endText, found := strings.Cut(value, "-")
+	if !found {
+		return Window{}, fmt.Errorf("invalid window %q, expected e.g. 08:00-21:00", value)
+	}
+
+	start, err := parseClock(strings.TrimSpace(startText))
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %v", value, err)
+	}
+	end, err := parseClock(strings.TrimSpace(endText))
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %v", value, err)
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("invalid window %q: start and end are the same", value)
+	}
+
+	return Window{start: start, end: end}, nil
+}
+
+func parseClock(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time of day %q", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func (w Window) String() string {
+	clock := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return clock(w.start) + "-" + clock(w.end)
+}
+
+// Contains reports whether t, in its own location, is inside the window.
+func (w Window) Contains(t time.Time) bool {
+	offset := sinceMidnight(t)
+	if w.start < w.end {
+		return offset >= w.start && offset < w.end
+	}
+	return offset >= w.start || offset < w.end
+}
+
+// Next returns t when it is inside the window, or the next time the window
+// opens otherwise.
+func (w Window) Next(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+
+	year, month, day := t.Date()
+	opening := time.Date(year, month, day, int(w.start.Hours()), int(w.start.Minutes())%60, 0, 0, t.Location())
+	if !opening.After(t) {
+		opening = time.Date(year, month, day+1, int(w.start.Hours()), int(w.start.Minutes())%60, 0, 0, t.Location())
+	}
+	return opening
+}
+
+func sinceMidnight(t time.Time) time.Duration {
+	hour, minute, second := t.Clock()
+	return time.Duration(hour)*time.Hour + time.Duration(minute)*time.Minute + time.Duration(second)*time.Second
+}
+
+// Schedule decides when the emails of a campaign may be sent: not before
+// SendAt and, when there is a Window, only inside it in Location.
+type Schedule struct {
+	SendAt   time.Time
+	Window   *Window
+	Location *time.Location
+	// WallClock reports whether SendAt was given without a UTC offset, so it
+	// is a time of day that follows the location of each recipient.
+	WallClock bool
+}
+
+// New parses the schedule settings of a campaign. Every argument is optional:
+// an empty timezone means the local one.
+func New(sendAt, window, timezone string) (Schedule, error) {
+	s := Schedule{Location: time.Local}
+
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return Schedule{}, fmt.Errorf("invalid timezone %q: %v", timezone, err)
+		}
+		s.Location = loc
+	}
+
+	if sendAt != "" {
+		t, wallClock, err := parseTime(sendAt, s.Location)
+		if err != nil {
+			return Schedule{}, err
+		}
+		s.SendAt = t
+		s.WallClock = wallClock
+	}
+
+	if window != "" {
+		w, err := ParseWindow(window)
+		if err != nil {
+			return Schedule{}, err
+		}
+		s.Window = &w
+	}
+
+	return s, nil
+}
+
+// For returns the schedule of a recipient in loc: its window is followed in
+// loc and, when SendAt is a wall clock time, it is the same time of day in loc.
+// A nil loc keeps the schedule unchanged.
+func (s Schedule) For(loc *time.Location) Schedule {
+	if loc == nil {
+		return s
+	}
+
+	if s.WallClock && !s.SendAt.IsZero() {
+		local := s.SendAt.In(s.Location)
+		year, month, day := local.Date()
+		hour, minute, second := local.Clock()
+		s.SendAt = time.Date(year, month, day, hour, minute, second, local.Nanosecond(), loc)
+	}
+	s.Location = loc
+
+	return s
+}
+
+// Next returns the first time at or after t when emails may be sent.
+func (s Schedule) Next(t time.Time) time.Time {
+	if t.Before(s.SendAt) {
+		t = s.SendAt
+	}
+	if s.Window == nil {
+		return t
+	}
+	return s.Window.Next(t.In(s.Location))
+}
+
+// Allowed reports whether emails may be sent at t.
+func (s Schedule) Allowed(t time.Time) bool {
+	return s.Next(t).Equal(t)
+}
+
+// Wait blocks until emails may be sent or the context is done. onPause, when
+// not nil, is called with the time sending resumes whenever Wait has to block.
+func (s Schedule) Wait(ctx context.Context, onPause func(resumeAt time.Time)) error {
+	now := time.Now()
+	next := s.Next(now)
+	if !next.After(now) {
+		return nil
+	}
+
+	if onPause != nil {
+		onPause(next)
+	}
+
+	timer := time.NewTimer(time.Until(next))
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,266 @@
+package schedule_test
+
+import (
+	"context"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/schedule"
+)
+
+func mustLoadLocation(t *testing.T, name string) *time.Location {
+	t.Helper()
+
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		t.Fatalf("Failed to load location %s: %v", name, err)
+	}
+	return loc
+}
+
+func TestParseTime(t *testing.T) {
+	saoPaulo := mustLoadLocation(t, "America/Sao_Paulo")
+	expected := time.Date(2024, 8, 6, 11, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		value       string
+		expectError bool
+	}{
+		"RFC 3339":           {value: "2024-08-06T08:00:00-03:00"},
+		"Wall Clock":         {value: "2024-08-06 08:00"},
+		"Wall Clock with T":  {value: "2024-08-06T08:00"},
+		"Wall Clock Seconds": {value: "2024-08-06 08:00:00"},
+		"Invalid":            {value: "tomorrow at 8", expectError: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, err := schedule.ParseTime(tt.value, saoPaulo)
+			if (err != nil) != tt.expectError {
+				t.Fatalf("expected error = %v, got %v", tt.expectError, err)
+			}
+			if err == nil && !got.Equal(expected) {
+				t.Errorf("expected %v, got %v", expected, got)
+			}
+		})
+	}
+}
+
+func TestWindow_Next(t *testing.T) {
+	tests := map[string]struct {
+		window   string
+		now      time.Time
+		expected time.Time
+	}{
+		"Inside": {
+			window:   "08:00-21:00",
+			now:      time.Date(2024, 8, 6, 12, 30, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 6, 12, 30, 0, 0, time.UTC),
+		},
+		"Before Opening": {
+			window:   "08:00-21:00",
+			now:      time.Date(2024, 8, 6, 3, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 6, 8, 0, 0, 0, time.UTC),
+		},
+		"After Closing": {
+			window:   "08:00-21:00",
+			now:      time.Date(2024, 8, 6, 21, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 7, 8, 0, 0, 0, time.UTC),
+		},
+		"Across Midnight Inside": {
+			window:   "22:00-06:00",
+			now:      time.Date(2024, 8, 6, 2, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 6, 2, 0, 0, 0, time.UTC),
+		},
+		"Across Midnight Outside": {
+			window:   "22:00-06:00",
+			now:      time.Date(2024, 8, 6, 12, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 6, 22, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w, err := schedule.ParseWindow(tt.window)
+			if err != nil {
+				t.Fatalf("Failed to parse window: %v", err)
+			}
+			if got := w.Next(tt.now); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+		})
+	}
+}
+
+func TestParseWindow(t *testing.T) {
+	for _, value := range []string{"08:00", "8h-21h", "08:00-08:00", "25:00-26:00"} {
+		if _, err := schedule.ParseWindow(value); err == nil {
+			t.Errorf("expected error for window %q", value)
+		}
+	}
+
+	w, err := schedule.ParseWindow("8:00 - 21:30")
+	if err != nil || w.String() != "08:00-21:30" {
+		t.Errorf("expected window 08:00-21:30, got %v (error %v)", w, err)
+	}
+}
+
+func TestSchedule_Next(t *testing.T) {
+	s, err := schedule.New("2024-08-06 07:00", "08:00-21:00", "America/Sao_Paulo")
+	if err != nil {
+		t.Fatalf("Failed to create schedule: %v", err)
+	}
+
+	tests := map[string]struct {
+		now      time.Time
+		expected time.Time
+	}{
+		"Before SendAt and Window": {
+			now:      time.Date(2024, 8, 5, 12, 0, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 6, 11, 0, 0, 0, time.UTC),
+		},
+		"Inside Window in Sao Paulo": {
+			now:      time.Date(2024, 8, 6, 23, 30, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 6, 23, 30, 0, 0, time.UTC),
+		},
+		"After Window in Sao Paulo": {
+			now:      time.Date(2024, 8, 7, 0, 30, 0, 0, time.UTC),
+			expected: time.Date(2024, 8, 7, 11, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := s.Next(tt.now); !got.Equal(tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, got)
+			}
+			if allowed := s.Allowed(tt.now); allowed != tt.now.Equal(tt.expected) {
+				t.Errorf("expected allowed = %v", !allowed)
+			}
+		})
+	}
+}
+
+func TestSchedule_For(t *testing.T) {
+	lisbon := mustLoadLocation(t, "Europe/Lisbon")
+
+	tests := map[string]struct {
+		sendAt         string
+		loc            *time.Location
+		expectedSendAt time.Time
+	}{
+		"Wall Clock Follows Recipient": {
+			sendAt:         "2024-08-06 08:00",
+			loc:            lisbon,
+			expectedSendAt: time.Date(2024, 8, 6, 7, 0, 0, 0, time.UTC),
+		},
+		"Absolute Time Is Kept": {
+			sendAt:         "2024-08-06T08:00:00-03:00",
+			loc:            lisbon,
+			expectedSendAt: time.Date(2024, 8, 6, 11, 0, 0, 0, time.UTC),
+		},
+		"No Recipient Timezone": {
+			sendAt:         "2024-08-06 08:00",
+			loc:            nil,
+			expectedSendAt: time.Date(2024, 8, 6, 11, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			s, err := schedule.New(tt.sendAt, "08:00-21:00", "America/Sao_Paulo")
+			if err != nil {
+				t.Fatalf("Failed to create schedule: %v", err)
+			}
+
+			recipient := s.For(tt.loc)
+			if !recipient.SendAt.Equal(tt.expectedSendAt) {
+				t.Errorf("expected send at %v, got %v", tt.expectedSendAt, recipient.SendAt)
+			}
+		})
+	}
+
+	s, _ := schedule.New("", "08:00-21:00", "America/Sao_Paulo")
+	lateInSaoPaulo := time.Date(2024, 8, 6, 23, 30, 0, 0, time.UTC)
+	if !s.Allowed(lateInSaoPaulo) {
+		t.Errorf("expected 20:30 in Sao Paulo to be inside the window")
+	}
+	if s.For(lisbon).Allowed(lateInSaoPaulo) {
+		t.Errorf("expected 00:30 in Lisbon to be outside the window")
+	}
+}
+
+func TestSchedule_Wait(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	paused := false
+	s := schedule.Schedule{SendAt: time.Now().Add(time.Hour), Location: time.UTC}
+
+	go cancel()
+	err := s.Wait(ctx, func(time.Time) { paused = true })
+	if err == nil || !paused {
+		t.Errorf("expected paused wait to be cancelled, got paused = %v and error %v", paused, err)
+	}
+
+	if err := (schedule.Schedule{Location: time.UTC}).Wait(context.Background(), nil); err != nil {
+		t.Errorf("expected empty schedule not to wait, got %v", err)
+	}
+}
+
+func TestState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "schedule.json")
+	entry := schedule.Entry{SendAt: "2024-08-06 08:00", Window: "08:00-21:00", Timezone: "America/Sao_Paulo"}
+
+	state, err := schedule.LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if err := state.Set("standard/workshop-reminder-final.html:data.csv", entry); err != nil {
+		t.Fatalf("Failed to save state: %v", err)
+	}
+
+	reloaded, err := schedule.LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to reload state: %v", err)
+	}
+	got, ok := reloaded.Get("standard/workshop-reminder-final.html:data.csv")
+	if !ok || !reflect.DeepEqual(got, entry) {
+		t.Fatalf("expected saved entry %+v, got %+v", entry, got)
+	}
+
+	// Another process may save its own campaign in between.
+	other, err := schedule.LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to load state: %v", err)
+	}
+	if err := other.MarkSent("standard/workshop-confirmation.html:data.csv", "ana@example.com"); err != nil {
+		t.Fatalf("Failed to mark recipient as sent: %v", err)
+	}
+	for _, email := range []string{"bia@example.com", "caio@example.com"} {
+		if err := reloaded.MarkSent("standard/workshop-reminder-final.html:data.csv", email); err != nil {
+			t.Fatalf("Failed to mark recipient as sent: %v", err)
+		}
+	}
+
+	reloaded, err = schedule.LoadState(path)
+	if err != nil {
+		t.Fatalf("Failed to reload state: %v", err)
+	}
+	entry.Sent = []string{"bia@example.com", "caio@example.com"}
+	if got, _ := reloaded.Get("standard/workshop-reminder-final.html:data.csv"); !reflect.DeepEqual(got, entry) {
+		t.Errorf("expected entry %+v, got %+v", entry, got)
+	}
+	if got, _ := reloaded.Get("standard/workshop-confirmation.html:data.csv"); !reflect.DeepEqual(got.Sent, []string{"ana@example.com"}) {
+		t.Errorf("expected the recipient of the other campaign to be kept, got %+v", got)
+	}
+
+	if err := reloaded.Delete("standard/workshop-reminder-final.html:data.csv"); err != nil {
+		t.Fatalf("Failed to delete entry: %v", err)
+	}
+	reloaded, _ = schedule.LoadState(path)
+	if _, ok := reloaded.Get("standard/workshop-reminder-final.html:data.csv"); ok {
+		t.Errorf("expected entry to be deleted")
+	}
+}
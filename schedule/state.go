@@ -0,0 +1,136 @@
+package schedule
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/reneepc/gopher-lite-mailer/lockfile"
+)
+
+// Entry is the schedule of a campaign as given by the user, kept so that a
+// restarted process waits for the same time and window, along with the
+// recipients already sent to, so it does not send to them again.
+type Entry struct {
+	SendAt   string   `json:"send_at,omitempty"`
+	Window   string   `json:"window,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+	Sent     []string `json:"sent,omitempty"`
+}
+
+// IsZero reports whether the entry has no schedule.
+func (e Entry) IsZero() bool {
+	return e.SendAt == "" && e.Window == "" && e.Timezone == ""
+}
+
+// Schedule parses the entry.
+func (e Entry) Schedule() (Schedule, error) {
+	return New(e.SendAt, e.Window, e.Timezone)
+}
+
+// State is a JSON file with the entry of each unfinished campaign. Several
+// processes may send different campaigns at the same time, so each change
+// locks the file and is applied to its latest content.
+type State struct {
+	path    string
+	entries map[string]Entry
+}
+
+// LoadState reads the state file. A missing file is an empty state.
+func LoadState(path string) (*State, error) {
+	entries, err := readState(path)
+	if err != nil {
+		return nil, err
+	}
+	return &State{path: path, entries: entries}, nil
+}
+
+func readState(path string) (map[string]Entry, error) {
+	entries := make(map[string]Entry)
+
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not read schedule state: %v", err)
+	}
+
+	if err := json.Unmarshal(content, &entries); err != nil {
+		return nil, fmt.Errorf("could not parse schedule state %s: %v", path, err)
+	}
+
+	return entries, nil
+}
+
+func (s *State) Get(campaign string) (Entry, bool) {
+	entry, ok := s.entries[campaign]
+	return entry, ok
+}
+
+func (s *State) Set(campaign string, entry Entry) error {
+	return s.update(func(entries map[string]Entry) {
+		entries[campaign] = entry
+	})
+}
+
+// MarkSent adds the recipient to the ones the campaign was sent to.
+func (s *State) MarkSent(campaign, email string) error {
+	return s.update(func(entries map[string]Entry) {
+		entry := entries[campaign]
+		entry.Sent = append(entry.Sent, email)
+		entries[campaign] = entry
+	})
+}
+
+func (s *State) Delete(campaign string) error {
+	if _, ok := s.entries[campaign]; !ok {
+		return nil
+	}
+	return s.update(func(entries map[string]Entry) {
+		delete(entries, campaign)
+	})
+}
+
+// update applies the change to the latest content of the file and saves it.
+func (s *State) update(change func(map[string]Entry)) error {
+	unlock, err := lockfile.Lock(s.path + ".lock")
+	if err != nil {
+		return fmt.Errorf("could not lock schedule state: %v", err)
+	}
+	defer unlock()
+
+	entries, err := readState(s.path)
+	if err != nil {
+		return err
+	}
+	change(entries)
+
+	content, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("could not encode schedule state: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("could not write schedule state: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return fmt.Errorf("could not write schedule state: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("could not write schedule state: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), s.path); err != nil {
+		return fmt.Errorf("could not write schedule state: %v", err)
+	}
+
+	s.entries = entries
+	return nil
+}
@@ -0,0 +1,277 @@
+package spool
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Directories of a spool. Jobs are written to New, moved to Processing while
+// they are being sent and end up in Done or Failed.
+const (
+	New        = "new"
+	Processing = "processing"
+	Done       = "done"
+	Failed     = "failed"
+)
+
+// Ext is the extension of job files. Files with any other extension in New,
+// such as the temporary file of a job still being written, are ignored.
+const Ext = ".json"
+
+// sendingExt is the extension of the marker written to Processing next to a
+// job right before it is delivered.
+const sendingExt = ".sending"
+
+// Job is an email enqueued by another program.
+type Job struct {
+	To string `json:"to"`
+	// Dir is the template directory under templates/. It defaults to the one
+	// of the daemon.
+	Dir     string            `json:"dir,omitempty"`
+	Body    string            `json:"body"`
+	Subject string            `json:"subject,omitempty"`
+	Data    map[string]string `json:"data,omitempty"`
+}
+
+// Validate checks that the job has a valid recipient and a body template that
+// stays inside the templates directory.
+func (j Job) Validate() error {
+	var errs []error
+
+	if j.To == "" {
+		errs = append(errs, errors.New("to: is required"))
+	} else if _, err := mail.ParseAddress(j.To); err != nil {
+		errs = append(errs, fmt.Errorf("to: invalid address %q", j.To))
+	}
+
+	if j.Body == "" {
+		errs = append(errs, errors.New("body: is required"))
+	} else if !filepath.IsLocal(j.Body) {
+		errs = append(errs, fmt.Errorf("body: invalid file name %q", j.Body))
+	}
+	if j.Dir != "" && !filepath.IsLocal(j.Dir) {
+		errs = append(errs, fmt.Errorf("dir: invalid directory %q", j.Dir))
+	}
+
+	return errors.Join(errs...)
+}
+
+// Spool is a directory of job files. Every state change of a job is a rename
+// within the spool, so a job is always in exactly one directory, even if the
+// process is killed halfway.
+type Spool struct {
+	root string
+}
+
+// Open creates the directories of the spool under root if needed.
+func Open(root string) (*Spool, error) {
+	for _, dir := range []string{New, Processing, Done, Failed} {
+		if err := os.MkdirAll(filepath.Join(root, dir), 0700); err != nil {
+			return nil, fmt.Errorf("could not create spool directory: %v", err)
+		}
+	}
+	return &Spool{root: root}, nil
+}
+
+// Recover handles the jobs left in Processing by a previous run. The ones
+// that were not being delivered yet are moved back to New and returned as
+// requeued. The ones marked by MarkSending may have been accepted by the
+// server before the run stopped, so they are moved to Failed instead of being
+// sent twice, and returned as interrupted.
+func (s *Spool) Recover() (requeued, interrupted []string, err error) {
+	names, err := s.list(Processing)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, name := range names {
+		if _, err := os.Stat(s.sendingPath(name)); err == nil {
+			reason := errors.New("interrupted while being sent, so it may have been delivered. Move it back to new to send it again")
+			if err := s.Fail(name, reason); err != nil {
+				return nil, nil, err
+			}
+			interrupted = append(interrupted, name)
+			continue
+		}
+		if err := s.move(name, Processing, New); err != nil {
+			return nil, nil, err
+		}
+		requeued = append(requeued, name)
+	}
+
+	// Markers of jobs that were moved out of Processing right before the
+	// previous run stopped.
+	markers, err := filepath.Glob(filepath.Join(s.root, Processing, "*"+sendingExt))
+	if err != nil {
+		return nil, nil, fmt.Errorf("could not read spool directory: %v", err)
+	}
+	for _, marker := range markers {
+		if err := os.Remove(marker); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, nil, fmt.Errorf("could not remove marker %s: %v", filepath.Base(marker), err)
+		}
+	}
+
+	return requeued, interrupted, nil
+}
+
+// Pending returns the names of the jobs waiting in New, oldest first.
+func (s *Spool) Pending() ([]string, error) {
+	return s.list(New)
+}
+
+// Claim moves the job from New to Processing and reads it. A job that cannot
+// be parsed or is invalid is moved to Failed and returned with an error, and so
+// is a job with the name of one that is already done, so a job enqueued twice
+// is not sent twice.
+func (s *Spool) Claim(name string) (Job, error) {
+	if err := s.move(name, New, Processing); err != nil {
+		return Job{}, err
+	}
+
+	job, err := s.read(name)
+	if err != nil {
+		if failErr := s.Fail(name, err); failErr != nil {
+			return Job{}, errors.Join(err, failErr)
+		}
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+func (s *Spool) read(name string) (Job, error) {
+	if _, err := os.Stat(s.path(Done, name)); err == nil {
+		return Job{}, fmt.Errorf("job %s was already sent", name)
+	}
+
+	content, err := os.ReadFile(s.path(Processing, name))
+	if err != nil {
+		return Job{}, fmt.Errorf("could not read job %s: %v", name, err)
+	}
+
+	var job Job
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&job); err != nil {
+		return Job{}, fmt.Errorf("could not parse job %s: %v", name, err)
+	}
+	if err := job.Validate(); err != nil {
+		return Job{}, fmt.Errorf("invalid job %s: %v", name, err)
+	}
+
+	return job, nil
+}
+
+// MarkSending records that a claimed job is about to be delivered, so Recover
+// does not send it again if the process stops before the job is completed. It
+// must be called right before the job is handed to the server.
+func (s *Spool) MarkSending(name string) error {
+	f, err := os.OpenFile(s.sendingPath(name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0600)
+	if err != nil {
+		return fmt.Errorf("could not mark job %s as sending: %v", name, err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("could not mark job %s as sending: %v", name, err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("could not mark job %s as sending: %v", name, err)
+	}
+	return nil
+}
+
+// Release moves a claimed job back to New, to be tried again later. It is
+// only safe for jobs the server did not accept.
+func (s *Spool) Release(name string) error {
+	return s.moveClaimed(name, New)
+}
+
+// Complete moves a claimed job to Done.
+func (s *Spool) Complete(name string) error {
+	return s.moveClaimed(name, Done)
+}
+
+// Fail moves a claimed job to Failed, next to a file with the same name and
+// the ".error" extension describing why it failed.
+func (s *Spool) Fail(name string, reason error) error {
+	errorFile := s.path(Failed, strings.TrimSuffix(name, Ext)+".error")
+	if err := os.WriteFile(errorFile, []byte(reason.Error()+"\n"), 0600); err != nil {
+		return fmt.Errorf("could not write error of job %s: %v", name, err)
+	}
+	return s.moveClaimed(name, Failed)
+}
+
+// moveClaimed moves a job out of Processing and then removes its marker, so
+// a job is never left in Processing without the marker once it was sending.
+func (s *Spool) moveClaimed(name, to string) error {
+	if err := s.move(name, Processing, to); err != nil {
+		return err
+	}
+	if err := os.Remove(s.sendingPath(name)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("could not remove marker of job %s: %v", name, err)
+	}
+	return nil
+}
+
+// list returns the job files of dir sorted by modification time, then name.
+func (s *Spool) list(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(s.root, dir))
+	if err != nil {
+		return nil, fmt.Errorf("could not read spool directory: %v", err)
+	}
+
+	type job struct {
+		name string
+		info fs.FileInfo
+	}
+	var jobs []job
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != Ext {
+			continue
+		}
+		info, err := entry.Info()
+		if errors.Is(err, fs.ErrNotExist) {
+			// Claimed by another process in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("could not read spool directory: %v", err)
+		}
+		jobs = append(jobs, job{name: entry.Name(), info: info})
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		if !jobs[i].info.ModTime().Equal(jobs[j].info.ModTime()) {
+			return jobs[i].info.ModTime().Before(jobs[j].info.ModTime())
+		}
+		return jobs[i].name < jobs[j].name
+	})
+
+	names := make([]string, len(jobs))
+	for i, job := range jobs {
+		names[i] = job.name
+	}
+	return names, nil
+}
+
+func (s *Spool) move(name, from, to string) error {
+	if err := os.Rename(s.path(from, name), s.path(to, name)); err != nil {
+		return fmt.Errorf("could not move job %s to %s: %v", name, to, err)
+	}
+	return nil
+}
+
+func (s *Spool) path(dir, name string) string {
+	return filepath.Join(s.root, dir, name)
+}
+
+func (s *Spool) sendingPath(name string) string {
+	return s.path(Processing, strings.TrimSuffix(name, Ext)+sendingExt)
+}
@@ -0,0 +1,138 @@
+package spool_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/spool"
+)
+
+func writeJob(t *testing.T, root, name, content string, modTime time.Time) {
+	t.Helper()
+
+	path := filepath.Join(root, spool.New, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write job: %v", err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatalf("Failed to set job time: %v", err)
+	}
+}
+
+func assertExists(t *testing.T, root, dir, name string) {
+	t.Helper()
+
+	if _, err := os.Stat(filepath.Join(root, dir, name)); err != nil {
+		t.Errorf("expected %s in %s: %v", name, dir, err)
+	}
+}
+
+func TestSpool(t *testing.T) {
+	root := t.TempDir()
+	s, err := spool.Open(root)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+
+	now := time.Now()
+	valid := `{"to": "gopher@example.com", "body": "workshop-confirmation.html", "data": {"Nome": "Gopher"}}`
+	writeJob(t, root, "b.json", valid, now.Add(-2*time.Minute))
+	writeJob(t, root, "a.json", valid, now.Add(-time.Minute))
+	writeJob(t, root, "invalid.json", `{"to": "gopher", "body": "../secret.html"}`, now)
+	writeJob(t, root, "writing.json.tmp", valid, now)
+
+	pending, err := s.Pending()
+	if err != nil {
+		t.Fatalf("Failed to list pending jobs: %v", err)
+	}
+	if strings.Join(pending, ",") != "b.json,a.json,invalid.json" {
+		t.Fatalf("expected jobs oldest first without temporary files, got %v", pending)
+	}
+
+	job, err := s.Claim("b.json")
+	if err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	if job.To != "gopher@example.com" || job.Data["Nome"] != "Gopher" {
+		t.Errorf("unexpected job: %+v", job)
+	}
+	assertExists(t, root, spool.Processing, "b.json")
+	if err := s.Complete("b.json"); err != nil {
+		t.Fatalf("Failed to complete job: %v", err)
+	}
+	assertExists(t, root, spool.Done, "b.json")
+
+	_, err = s.Claim("invalid.json")
+	if err == nil || !strings.Contains(err.Error(), "to: invalid address") || !strings.Contains(err.Error(), "body: invalid file name") {
+		t.Fatalf("expected validation error, got %v", err)
+	}
+	assertExists(t, root, spool.Failed, "invalid.json")
+	assertExists(t, root, spool.Failed, "invalid.error")
+
+	writeJob(t, root, "b.json", valid, now)
+	if _, err := s.Claim("b.json"); err == nil || !strings.Contains(err.Error(), "already sent") {
+		t.Fatalf("expected duplicate job error, got %v", err)
+	}
+	assertExists(t, root, spool.Failed, "b.json")
+
+	if _, err := s.Claim("a.json"); err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	writeJob(t, root, "c.json", valid, now)
+	if _, err := s.Claim("c.json"); err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	if err := s.MarkSending("c.json"); err != nil {
+		t.Fatalf("Failed to mark job as sending: %v", err)
+	}
+
+	// A restart queues the job that was not being delivered yet again, and
+	// fails the one that may have been delivered instead of sending it twice.
+	reopened, err := spool.Open(root)
+	if err != nil {
+		t.Fatalf("Failed to reopen spool: %v", err)
+	}
+	requeued, interrupted, err := reopened.Recover()
+	if err != nil {
+		t.Fatalf("Failed to recover jobs: %v", err)
+	}
+	if len(requeued) != 1 || requeued[0] != "a.json" {
+		t.Errorf("expected a.json to be requeued, got %v", requeued)
+	}
+	if len(interrupted) != 1 || interrupted[0] != "c.json" {
+		t.Errorf("expected c.json to be interrupted, got %v", interrupted)
+	}
+	assertExists(t, root, spool.New, "a.json")
+	assertExists(t, root, spool.Failed, "c.json")
+	assertExists(t, root, spool.Failed, "c.error")
+	if entries, err := os.ReadDir(filepath.Join(root, spool.Processing)); err != nil || len(entries) != 0 {
+		t.Errorf("expected processing to be empty, got %v (error %v)", entries, err)
+	}
+}
+
+func TestSpool_CompleteRemovesMarker(t *testing.T) {
+	root := t.TempDir()
+	s, err := spool.Open(root)
+	if err != nil {
+		t.Fatalf("Failed to open spool: %v", err)
+	}
+
+	writeJob(t, root, "a.json", `{"to": "gopher@example.com", "body": "workshop-confirmation.html"}`, time.Now())
+	if _, err := s.Claim("a.json"); err != nil {
+		t.Fatalf("Failed to claim job: %v", err)
+	}
+	if err := s.MarkSending("a.json"); err != nil {
+		t.Fatalf("Failed to mark job as sending: %v", err)
+	}
+	if err := s.Complete("a.json"); err != nil {
+		t.Fatalf("Failed to complete job: %v", err)
+	}
+
+	assertExists(t, root, spool.Done, "a.json")
+	if entries, err := os.ReadDir(filepath.Join(root, spool.Processing)); err != nil || len(entries) != 0 {
+		t.Errorf("expected processing to be empty, got %v (error %v)", entries, err)
+	}
+}
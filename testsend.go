@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/reneepc/gopher-lite-mailer/logging"
+)
+
+func runTest(args []string) error {
+	fs := newFlagSet("test", "<recipient> [email]",
+		"Sends the email rendered with the first row of the data file to the given recipient,\n"+
+			"so the campaign can be checked in a real inbox before it is sent to everyone.")
+	opts := newCampaignOptions(fs)
+	sender := newSenderOptions(fs)
+	fs.Parse(args)
+
+	c, err := opts.campaign()
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() < 1 {
+		fs.Usage()
+		return fmt.Errorf("recipient is required")
+	}
+	recipient := fs.Arg(0)
+
+	pool, _, err := sender.pool(c, fs.Args()[1:])
+	if err != nil {
+		return err
+	}
+
+	templateContent, err := loadTemplate(c)
+	if err != nil {
+		return err
+	}
+
+	records, err := loadRecords(c)
+	if err != nil {
+		return err
+	}
+
+	email, err := templateContent.Render(context.Background(), records[0].Data)
+	if err != nil {
+		return fmt.Errorf("could not execute template: %v", err)
+	}
+
+	account, err := pool.SendEmail(recipient, email)
+	if err != nil {
+		return fmt.Errorf("could not send test email: %v", err)
+	}
+
+	slog.Info("✅ Test email successfully sent", slog.String(logging.KeyRecipient, recipient), slog.String(logging.KeyAccount, account), slog.String("data_of", records[0].Email))
+	return nil
+}
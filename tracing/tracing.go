@@ -0,0 +1,83 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const serviceName = "gopher-lite-mailer"
+
+// Tracer creates the spans of the mailer. Until Setup is called it is a no-op,
+// so tracing costs nothing when disabled.
+func Tracer() trace.Tracer {
+	return otel.Tracer("github.com/reneepc/gopher-lite-mailer")
+}
+
+// End records the error, if any, on the span and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Exporter is where the spans are sent.
+type Exporter string
+
+const (
+	// ExporterNone disables tracing.
+	ExporterNone Exporter = ""
+	// ExporterOTLP sends the spans over OTLP/HTTP to the collector set in the
+	// OTEL_EXPORTER_OTLP_ENDPOINT environment variable, or localhost:4318.
+	ExporterOTLP Exporter = "otlp"
+	// ExporterStdout writes the spans as JSON, for debugging without a
+	// collector.
+	ExporterStdout Exporter = "stdout"
+)
+
+func ParseExporter(value string) (Exporter, error) {
+	switch exporter := Exporter(value); exporter {
+	case ExporterNone, ExporterOTLP, ExporterStdout:
+		return exporter, nil
+	}
+	return "", fmt.Errorf("invalid trace exporter %q, expected otlp or stdout", value)
+}
+
+// Setup makes Tracer export its spans with the exporter. Stdout spans are
+// written to out. The returned function flushes the pending spans and must be
+// called before exiting.
+func Setup(ctx context.Context, exporter Exporter, out io.Writer) (func(context.Context) error, error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(out), stdouttrace.WithPrettyPrint())
+	default:
+		return nil, fmt.Errorf("invalid trace exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not create %s trace exporter: %v", exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(serviceName))),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/mail"
+	"os"
+
+	"github.com/reneepc/gopher-lite-mailer/parser"
+)
+
+func runValidate(args []string) error {
+	fs := newFlagSet("validate", "",
+		"Parses the templates and the data file of a campaign and renders the email of every\n"+
+			"recipient, reporting every problem found. No email is sent.")
+	opts := newCampaignOptions(fs)
+	fs.Parse(args)
+
+	c, err := opts.campaign()
+	if err != nil {
+		return err
+	}
+
+	var problems []string
+	report := func(format string, args ...any) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	for _, attachment := range c.Attachments {
+		if _, err := os.Stat(attachment.File); err != nil {
+			report("attachment %s: %v", attachment.File, err)
+		}
+	}
+
+	templateContent, templateErr := loadTemplate(c)
+	if templateErr != nil {
+		report("%v", templateErr)
+	} else {
+		frontMatter := templateContent.FrontMatter()
+		if c.Subject == "" && frontMatter.Subject == "" {
+			report("subject is empty")
+		}
+		for _, attachment := range frontMatter.Attachments {
+			if _, err := os.Stat(attachment.FileName); err != nil {
+				report("front matter attachment %s: %v", attachment.FileName, err)
+			}
+		}
+	}
+
+	records, err := loadRecords(c)
+	if err != nil {
+		report("%v", err)
+	}
+
+	// Missing fields are reported once instead of on every data line. They
+	// are only errors in strict mode, where they would fail the rendering.
+	if c.Strict && templateErr == nil && err == nil {
+		if fieldsErr := templateContent.CheckFields(parser.Fields(records)); fieldsErr != nil {
+			report("%v", fieldsErr)
+			templateErr = fieldsErr
+		}
+	}
+
+	for i, record := range records {
+		// Data rows start on the second line, right after the header.
+		line := i + 2
+		if _, err := mail.ParseAddress(record.Email); err != nil {
+			report("data line %d: invalid email %q: %v", line, record.Email, err)
+		}
+		if templateErr == nil {
+			if _, err := templateContent.Render(context.Background(), record.Data); err != nil {
+				report("data line %d: %v", line, err)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Println("❌", problem)
+		}
+		return fmt.Errorf("found %d problems", len(problems))
+	}
+
+	fmt.Printf("✅ Campaign is valid: %d recipients\n", len(records))
+	return nil
+}
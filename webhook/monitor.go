@@ -0,0 +1,111 @@
+package webhook
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+)
+
+// Monitor turns the results of a campaign into events: its start and
+// completion, the error rate going over a threshold and each permanent
+// failure.
+type Monitor struct {
+	notifier *Notifier
+	campaign string
+	// threshold is the share of failed emails, from 0 to 1, over which the
+	// error rate event is sent, once at least minEmails were tried. Zero
+	// disables the event.
+	threshold float64
+	minEmails int
+
+	mu       sync.Mutex
+	summary  Summary
+	exceeded bool
+}
+
+func NewMonitor(notifier *Notifier, campaign string, threshold float64, minEmails int) *Monitor {
+	return &Monitor{
+		notifier:  notifier,
+		campaign:  campaign,
+		threshold: threshold,
+		minEmails: max(minEmails, 1),
+	}
+}
+
+// Start sends the campaign started event.
+func (m *Monitor) Start(total int) {
+	m.mu.Lock()
+	m.summary.Total = total
+	m.mu.Unlock()
+
+	m.notifier.Notify(Event{
+		Type:     EventCampaignStarted,
+		Campaign: m.campaign,
+		Text:     fmt.Sprintf("📤 Campaign %s started sending to %d recipients", m.campaign, total),
+		Summary:  &Summary{Total: total},
+	})
+}
+
+// Record counts the result of an email, sending the events it triggers.
+func (m *Monitor) Record(result mailer.RecordResult) {
+	m.mu.Lock()
+	switch result.Status {
+	case mailer.StatusSent:
+		m.summary.Sent++
+	case mailer.StatusFailed:
+		m.summary.Failed++
+	case mailer.StatusSkipped:
+		m.summary.Skipped++
+	}
+	summary := m.summary
+	tried := summary.Sent + summary.Failed
+	rate := 0.0
+	if tried > 0 {
+		rate = float64(summary.Failed) / float64(tried)
+	}
+	exceeded := !m.exceeded && m.threshold > 0 && tried >= m.minEmails && rate > m.threshold
+	if exceeded {
+		m.exceeded = true
+	}
+	m.mu.Unlock()
+
+	if result.Status == mailer.StatusFailed && result.Code >= 500 {
+		m.notifier.Notify(Event{
+			Type:     EventEmailFailed,
+			Campaign: m.campaign,
+			Text:     fmt.Sprintf("❌ Campaign %s could not send to %s: %v", m.campaign, result.Record.Email, result.Err),
+			Email: &Email{
+				Recipient: result.Record.Email,
+				SMTPCode:  result.Code,
+				SMTPReply: result.Response,
+				Error:     result.Err.Error(),
+			},
+		})
+	}
+
+	if exceeded {
+		m.notifier.Notify(Event{
+			Type:      EventErrorRateExceeded,
+			Campaign:  m.campaign,
+			Text:      fmt.Sprintf("🚨 Campaign %s is failing: %d of %d emails failed (%.0f%%)", m.campaign, summary.Failed, tried, rate*100),
+			Summary:   &summary,
+			ErrorRate: rate,
+		})
+	}
+}
+
+// Finish sends the campaign finished event.
+func (m *Monitor) Finish() {
+	m.mu.Lock()
+	summary := m.summary
+	m.mu.Unlock()
+
+	m.notifier.Notify(Event{
+		Type:     EventCampaignFinished,
+		Campaign: m.campaign,
+		Text: fmt.Sprintf("🏁 Campaign %s finished: %d sent, %d failed, %d skipped of %d",
+			m.campaign, summary.Sent, summary.Failed, summary.Skipped, summary.Total),
+		Summary: &summary,
+	})
+}
@@ -0,0 +1,270 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// EventType is the kind of campaign event sent to the webhooks.
+type EventType string
+
+const (
+	EventCampaignStarted  EventType = "campaign.started"
+	EventCampaignFinished EventType = "campaign.finished"
+	// EventErrorRateExceeded is sent once per campaign, when the share of
+	// failed emails goes over the threshold.
+	EventErrorRateExceeded EventType = "campaign.error_rate_exceeded"
+	// EventEmailFailed is sent for each email rejected by the server with a
+	// permanent (5xx) error.
+	EventEmailFailed EventType = "email.failed"
+)
+
+// EventTypes lists every event type.
+var EventTypes = []EventType{EventCampaignStarted, EventCampaignFinished, EventErrorRateExceeded, EventEmailFailed}
+
+// Headers of the webhook requests. The signature is the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the body, prefixed with "sha256=".
+const (
+	HeaderEvent     = "X-Gopher-Lite-Mailer-Event"
+	HeaderID        = "X-Gopher-Lite-Mailer-Id"
+	HeaderTimestamp = "X-Gopher-Lite-Mailer-Timestamp"
+	HeaderSignature = "X-Gopher-Lite-Mailer-Signature"
+)
+
+// Event is the JSON body of a webhook request. Text is a human readable
+// description, so chat services that post the "text" field of incoming
+// webhooks show it as a message.
+type Event struct {
+	ID        string    `json:"id"`
+	Type      EventType `json:"type"`
+	Time      time.Time `json:"time"`
+	Campaign  string    `json:"campaign"`
+	Text      string    `json:"text"`
+	Summary   *Summary  `json:"summary,omitempty"`
+	Email     *Email    `json:"email,omitempty"`
+	ErrorRate float64   `json:"error_rate,omitempty"`
+}
+
+// Summary counts the emails of the campaign so far.
+type Summary struct {
+	Total   int `json:"total"`
+	Sent    int `json:"sent"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+// Email describes a failed email.
+type Email struct {
+	Recipient string `json:"recipient"`
+	SMTPCode  int    `json:"smtp_code,omitempty"`
+	SMTPReply string `json:"smtp_reply,omitempty"`
+	Error     string `json:"error"`
+}
+
+// Endpoint is a URL the events are posted to. An empty Secret sends the
+// requests unsigned, and empty Events means every event.
+type Endpoint struct {
+	URL    string
+	Secret string
+	Events []EventType
+}
+
+func (e Endpoint) wants(eventType EventType) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, t := range e.Events {
+		if t == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// Notifier posts events to the endpoints in the background, in the order they
+// were notified. Requests that fail with a network error, a 429 or a 5xx
+// status are retried with an increasing delay.
+type Notifier struct {
+	// MaxAttempts is the number of times a request is tried. It defaults to 4.
+	MaxAttempts int
+	// RetryDelay is the wait before the second attempt, doubled for each
+	// following one. It defaults to 1 second.
+	RetryDelay time.Duration
+
+	client    *http.Client
+	endpoints []Endpoint
+	queues    []chan Event
+	wg        sync.WaitGroup
+	once      sync.Once
+}
+
+func NewNotifier(endpoints ...Endpoint) *Notifier {
+	return &Notifier{
+		MaxAttempts: 4,
+		RetryDelay:  time.Second,
+		client:      &http.Client{Timeout: 10 * time.Second},
+		endpoints:   endpoints,
+	}
+}
+
+// start creates a queue and a worker per endpoint on the first notification,
+// so the retry settings can be changed after NewNotifier.
+func (n *Notifier) start() {
+	n.once.Do(func() {
+		for _, endpoint := range n.endpoints {
+			queue := make(chan Event, 100)
+			n.queues = append(n.queues, queue)
+			n.wg.Add(1)
+			go func() {
+				defer n.wg.Done()
+				for event := range queue {
+					n.post(endpoint, event)
+				}
+			}()
+		}
+	})
+}
+
+// Notify queues the event to the endpoints that want it, filling its id and
+// time when empty.
+func (n *Notifier) Notify(event Event) {
+	if n == nil || len(n.endpoints) == 0 {
+		return
+	}
+	n.start()
+
+	if event.ID == "" {
+		event.ID = newID()
+	}
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	for i, endpoint := range n.endpoints {
+		if endpoint.wants(event.Type) {
+			n.queues[i] <- event
+		}
+	}
+}
+
+// Close waits for the queued events to be posted.
+func (n *Notifier) Close() {
+	if n == nil {
+		return
+	}
+	n.start()
+	for _, queue := range n.queues {
+		close(queue)
+	}
+	n.wg.Wait()
+}
+
+func (n *Notifier) post(endpoint Endpoint, event Event) {
+	body, err := json.Marshal(event)
+	if err != nil {
+		slog.Error("could not encode webhook event", slog.String("event", string(event.Type)), slog.Any("error", err))
+		return
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := n.send(endpoint, event, body)
+		if err == nil {
+			return
+		}
+
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= n.MaxAttempts {
+			slog.Error("could not send webhook", slog.String("url", endpoint.URL), slog.String("event", string(event.Type)),
+				slog.Int("attempts", attempt), slog.Any("error", err))
+			return
+		}
+		time.Sleep(n.RetryDelay << (attempt - 1))
+	}
+}
+
+// permanentError is a failed request that is not retried.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (n *Notifier) send(endpoint Endpoint, event Event, body []byte) error {
+	request, err := http.NewRequest(http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return &permanentError{err: err}
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "gopher-lite-mailer")
+	request.Header.Set(HeaderEvent, string(event.Type))
+	request.Header.Set(HeaderID, event.ID)
+	request.Header.Set(HeaderTimestamp, timestamp)
+	if endpoint.Secret != "" {
+		request.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+	}
+
+	response, err := n.client.Do(request)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, io.LimitReader(response.Body, 1<<16))
+	response.Body.Close()
+
+	switch {
+	case response.StatusCode >= 200 && response.StatusCode < 300:
+		return nil
+	case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+		return fmt.Errorf("webhook answered %s", response.Status)
+	}
+	return &permanentError{err: fmt.Errorf("webhook answered %s", response.Status)}
+}
+
+// Sign returns the signature header value of a request body sent at the
+// timestamp, in Unix seconds.
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature of a webhook request, and that it was sent at
+// most tolerance ago, so captured requests cannot be replayed later.
+func Verify(secret string, header http.Header, body []byte, tolerance time.Duration) error {
+	timestamp := header.Get(HeaderTimestamp)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid %s header %q", HeaderTimestamp, timestamp)
+	}
+	if age := time.Since(time.Unix(seconds, 0)); age > tolerance || age < -tolerance {
+		return fmt.Errorf("request timestamp is %s off", age.Round(time.Second))
+	}
+
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(header.Get(HeaderSignature))) {
+		return errors.New("invalid signature")
+	}
+	return nil
+}
+
+func newID() string {
+	random := make([]byte, 12)
+	rand.Read(random)
+	return hex.EncodeToString(random)
+}
@@ -0,0 +1,173 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/mailer"
+	"github.com/reneepc/gopher-lite-mailer/parser"
+	"github.com/reneepc/gopher-lite-mailer/webhook"
+)
+
+type receivedEvent struct {
+	event  webhook.Event
+	header http.Header
+	body   []byte
+}
+
+// newReceiver starts a server that answers the first failures requests with
+// 503 and records the others.
+func newReceiver(t *testing.T, failures int) (*httptest.Server, func() []receivedEvent) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var received []receivedEvent
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failures > 0 {
+			failures--
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		var event webhook.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			t.Errorf("invalid event body: %v", err)
+		}
+		received = append(received, receivedEvent{event: event, header: r.Header.Clone(), body: body})
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []receivedEvent {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedEvent(nil), received...)
+	}
+}
+
+func TestNotifier(t *testing.T) {
+	server, received := newReceiver(t, 2)
+
+	notifier := webhook.NewNotifier(webhook.Endpoint{URL: server.URL, Secret: "s3cr3t"})
+	notifier.RetryDelay = time.Millisecond
+	notifier.Notify(webhook.Event{Type: webhook.EventCampaignStarted, Campaign: "standard"})
+	notifier.Close()
+
+	events := received()
+	if len(events) != 1 {
+		t.Fatalf("expected the event to be delivered once after the retries, got %d", len(events))
+	}
+	got := events[0]
+	if got.event.Type != webhook.EventCampaignStarted || got.event.ID == "" || got.header.Get(webhook.HeaderID) != got.event.ID {
+		t.Errorf("unexpected event: %+v", got.event)
+	}
+	if err := webhook.Verify("s3cr3t", got.header, got.body, time.Minute); err != nil {
+		t.Errorf("expected a valid signature, got %v", err)
+	}
+	if err := webhook.Verify("other", got.header, got.body, time.Minute); err == nil {
+		t.Error("expected an invalid signature with another secret")
+	}
+}
+
+func TestNotifierEventFilter(t *testing.T) {
+	server, received := newReceiver(t, 0)
+
+	notifier := webhook.NewNotifier(webhook.Endpoint{URL: server.URL, Events: []webhook.EventType{webhook.EventCampaignFinished}})
+	notifier.Notify(webhook.Event{Type: webhook.EventCampaignStarted})
+	notifier.Notify(webhook.Event{Type: webhook.EventCampaignFinished})
+	notifier.Close()
+
+	events := received()
+	if len(events) != 1 || events[0].event.Type != webhook.EventCampaignFinished {
+		t.Errorf("expected only the finished event, got %+v", events)
+	}
+	if events[0].header.Get(webhook.HeaderSignature) != "" {
+		t.Error("expected no signature without a secret")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"campaign.started"}`)
+	signed := func(sentAt time.Time) http.Header {
+		timestamp := strconv.FormatInt(sentAt.Unix(), 10)
+		header := http.Header{}
+		header.Set(webhook.HeaderTimestamp, timestamp)
+		header.Set(webhook.HeaderSignature, webhook.Sign("s3cr3t", timestamp, body))
+		return header
+	}
+
+	tests := map[string]struct {
+		header      http.Header
+		body        []byte
+		expectError bool
+	}{
+		"Valid":          {header: signed(time.Now()), body: body},
+		"Changed Body":   {header: signed(time.Now()), body: []byte(`{"type":"campaign.finished"}`), expectError: true},
+		"Old Timestamp":  {header: signed(time.Now().Add(-time.Hour)), body: body, expectError: true},
+		"Missing Header": {header: http.Header{}, body: body, expectError: true},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := webhook.Verify("s3cr3t", tt.header, tt.body, 5*time.Minute)
+			if (err != nil) != tt.expectError {
+				t.Errorf("expected error = %v, got %v", tt.expectError, err)
+			}
+		})
+	}
+}
+
+func TestMonitor(t *testing.T) {
+	server, received := newReceiver(t, 0)
+	notifier := webhook.NewNotifier(webhook.Endpoint{URL: server.URL})
+
+	monitor := webhook.NewMonitor(notifier, "standard", 0.5, 2)
+	monitor.Start(4)
+	monitor.Record(mailer.RecordResult{Record: parser.MailRecord{Email: "a@example.com"}, Status: mailer.StatusSent})
+	monitor.Record(mailer.RecordResult{
+		Record: parser.MailRecord{Email: "b@example.com"},
+		Status: mailer.StatusFailed,
+		Code:   550,
+		Err:    &textproto.Error{Code: 550, Msg: "5.1.1 No such user"},
+	})
+	monitor.Record(mailer.RecordResult{
+		Record: parser.MailRecord{Email: "c@example.com"},
+		Status: mailer.StatusFailed,
+		Code:   451,
+		Err:    &textproto.Error{Code: 451, Msg: "4.3.0 Try again later"},
+	})
+	monitor.Record(mailer.RecordResult{Record: parser.MailRecord{Email: "d@example.com"}, Status: mailer.StatusSkipped, Err: errors.New("quota")})
+	monitor.Finish()
+	notifier.Close()
+
+	var types []webhook.EventType
+	for _, got := range received() {
+		types = append(types, got.event.Type)
+	}
+	// Only the 5xx failure is an email event, and the error rate goes over
+	// 50% with the third email.
+	expected := []webhook.EventType{webhook.EventCampaignStarted, webhook.EventEmailFailed, webhook.EventErrorRateExceeded, webhook.EventCampaignFinished}
+	if len(types) != len(expected) {
+		t.Fatalf("expected events %v, got %v", expected, types)
+	}
+	for i := range expected {
+		if types[i] != expected[i] {
+			t.Fatalf("expected events %v, got %v", expected, types)
+		}
+	}
+
+	finished := received()[3].event
+	if finished.Summary == nil || *finished.Summary != (webhook.Summary{Total: 4, Sent: 1, Failed: 2, Skipped: 1}) {
+		t.Errorf("unexpected summary: %+v", finished.Summary)
+	}
+}
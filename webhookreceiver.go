@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/reneepc/gopher-lite-mailer/credentials"
+	"github.com/reneepc/gopher-lite-mailer/webhook"
+)
+
+func runWebhookReceiver(args []string) error {
+	fs := newFlagSet("webhook-receiver", "",
+		"Listens for webhook requests and prints their events, checking their signature when\n"+
+			"a secret is given. Point a campaign to it with -webhook http://localhost:8090/ to\n"+
+			"see the events it sends.")
+	addr := fs.String("addr", "localhost:8090", "Address to listen on")
+	secretSource := fs.String("secret-source", "", "Where to read the key to check the signatures with, in the format of -password-source (not checked by default)")
+	fail := fs.Int("fail", 0, "Answer the first N requests with 503 Service Unavailable, to try the retries")
+	fs.Parse(args)
+
+	secret := ""
+	if *secretSource != "" {
+		source, err := credentials.Parse(*secretSource)
+		if err != nil {
+			return err
+		}
+		secret, err = source.Password("webhook")
+		if err != nil {
+			return fmt.Errorf("could not get webhook secret from %s: %v", source, err)
+		}
+	}
+
+	// Requests are handled one at a time, so the events are printed whole.
+	var mu sync.Mutex
+	failures := *fail
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		if err != nil {
+			http.Error(w, "could not read body", http.StatusBadRequest)
+			return
+		}
+
+		if secret != "" {
+			if err := webhook.Verify(secret, r.Header, body, 5*time.Minute); err != nil {
+				slog.Error("❌ Rejected webhook", slog.String("id", r.Header.Get(webhook.HeaderID)), slog.Any("error", err))
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+		}
+
+		if failures > 0 {
+			failures--
+			slog.Warn("💥 Failing webhook on purpose", slog.String("id", r.Header.Get(webhook.HeaderID)))
+			http.Error(w, "failing on purpose", http.StatusServiceUnavailable)
+			return
+		}
+
+		var event webhook.Event
+		if err := json.Unmarshal(body, &event); err != nil {
+			http.Error(w, "invalid event", http.StatusBadRequest)
+			return
+		}
+		slog.Info("📨 "+event.Text, slog.String("event", string(event.Type)), slog.String("id", event.ID), slog.Bool("signed", secret != ""))
+
+		pretty, _ := json.MarshalIndent(event, "", "  ")
+		fmt.Println(string(pretty))
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	server := &http.Server{
+		Addr:              *addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	context.AfterFunc(ctx, func() { server.Close() })
+
+	slog.Info("🪝 Webhook receiver listening", slog.String("addr", *addr))
+	if err := server.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}